@@ -0,0 +1,206 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Assertion checks a response whose status code is expected, returning an
+// error describing why the response is not valid
+type Assertion func(resp *http.Response, body []byte) error
+
+// WithAssertions is the functional option to add assertions every response
+// must pass to be successful while initializing a new Tester object
+func WithAssertions(assertions ...Assertion) Option {
+	return func(t *Tester) error {
+		for _, a := range assertions {
+			if a == nil {
+				return ErrValueCannotBeNil
+			}
+		}
+		t.assertions = append(t.assertions, assertions...)
+		return nil
+	}
+}
+
+// BodyContains asserts the response body contains s
+func BodyContains(s string) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		if !bytes.Contains(body, []byte(s)) {
+			return fmt.Errorf("body does not contain %q", s)
+		}
+		return nil
+	}
+}
+
+// BodyMatches asserts the response body matches the regular expression re
+func BodyMatches(re *regexp.Regexp) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match %q", re)
+		}
+		return nil
+	}
+}
+
+// HeaderExists asserts the response has the header name
+func HeaderExists(name string) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		if _, ok := resp.Header[http.CanonicalHeaderKey(name)]; !ok {
+			return fmt.Errorf("header %q not found", name)
+		}
+		return nil
+	}
+}
+
+// HeaderEquals asserts the header name of the response is value
+func HeaderEquals(name, value string) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		got := resp.Header.Get(name)
+		if got != value {
+			return fmt.Errorf("header %q is %q, want %q", name, got, value)
+		}
+		return nil
+	}
+}
+
+// JSONPathExists asserts the response body is a JSON document holding a value
+// at path. Paths are dot separated keys and array indexes, optionally starting
+// with $, e.g. $.data.items[0].id or data.items.0.id
+func JSONPathExists(path string) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		_, err := jsonPath(body, path)
+		return err
+	}
+}
+
+// JSONPathEquals asserts the value at path of the JSON response body is value.
+// Strings are compared without quotes, and any other value with its JSON
+// encoding, e.g. 42, true or null
+func JSONPathEquals(path, value string) Assertion {
+	return func(resp *http.Response, body []byte) error {
+		v, err := jsonPath(body, path)
+		if err != nil {
+			return err
+		}
+		got, err := jsonString(v)
+		if err != nil {
+			return err
+		}
+		if got != value {
+			return fmt.Errorf("JSON path %q is %q, want %q", path, got, value)
+		}
+		return nil
+	}
+}
+
+// jsonPath returns the value found at path in the JSON document body
+func jsonPath(body []byte, path string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("body is not valid JSON: %v", err)
+	}
+	for _, key := range jsonPathKeys(path) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("JSON path %q not found", path)
+			}
+			v = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("JSON path %q not found", path)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("JSON path %q not found", path)
+		}
+	}
+	return v, nil
+}
+
+// jsonPathKeys splits a path such as $.data.items[0].id into its keys
+func jsonPathKeys(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func jsonString(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseJSONAssertion parses a JSON path assertion in the format path=value,
+// or just path to assert the path exists
+func parseJSONAssertion(s string) (Assertion, error) {
+	path, value, ok := strings.Cut(s, "=")
+	if path == "" {
+		return nil, fmt.Errorf("invalid JSON assertion %q, want path or path=value", s)
+	}
+	if !ok {
+		return JSONPathExists(path), nil
+	}
+	return JSONPathEquals(path, value), nil
+}
+
+// parseHeaderAssertion parses a header assertion in the format "name: value",
+// or just name to assert the header exists
+func parseHeaderAssertion(s string) (Assertion, error) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("invalid header assertion %q, want name or name: value", s)
+	}
+	if !ok {
+		return HeaderExists(name), nil
+	}
+	return HeaderEquals(name, strings.TrimSpace(value)), nil
+}
+
+// assert runs every assertion against a response, returning the errors of the
+// ones failing
+func (t *Tester) assert(resp *http.Response, body []byte) error {
+	var errs []error
+	for _, a := range t.assertions {
+		err := a(resp, body)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// assertionError is the failure of a response not passing the assertions, or
+// missing a value to extract
+type assertionError struct {
+	err error
+}
+
+func (e assertionError) Error() string {
+	return e.err.Error()
+}
+
+func (e assertionError) Unwrap() error {
+	return e.err
+}
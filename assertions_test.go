@@ -0,0 +1,144 @@
+package bench_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thiagonache/bench"
+)
+
+func TestAssertions_PassOnValidResponse(t *testing.T) {
+	t.Parallel()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": []string{"no-cache"}},
+	}
+	body := []byte(`{"status": "ok", "data": {"items": [{"id": 42, "name": "gopher", "active": true}]}}`)
+	assertions := map[string]bench.Assertion{
+		"BodyContains":             bench.BodyContains(`"status": "ok"`),
+		"BodyMatches":              bench.BodyMatches(regexp.MustCompile(`"id": \d+`)),
+		"HeaderExists":             bench.HeaderExists("cache-control"),
+		"HeaderEquals":             bench.HeaderEquals("Cache-Control", "no-cache"),
+		"JSONPathExists":           bench.JSONPathExists("$.data.items[0].name"),
+		"JSONPathEquals/string":    bench.JSONPathEquals("$.data.items[0].name", "gopher"),
+		"JSONPathEquals/number":    bench.JSONPathEquals("data.items.0.id", "42"),
+		"JSONPathEquals/bool":      bench.JSONPathEquals("$.data.items[0].active", "true"),
+		"JSONPathEquals/root key":  bench.JSONPathEquals("status", "ok"),
+		"JSONPathExists/root node": bench.JSONPathExists("$"),
+	}
+	for name, a := range assertions {
+		err := a(resp, body)
+		if err != nil {
+			t.Errorf("%s: want no error, got %v", name, err)
+		}
+	}
+}
+
+func TestAssertions_FailOnInvalidResponse(t *testing.T) {
+	t.Parallel()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": []string{"max-age=3600"}},
+	}
+	body := []byte(`{"status": "error", "data": {"items": []}}`)
+	assertions := map[string]bench.Assertion{
+		"BodyContains":           bench.BodyContains(`"status": "ok"`),
+		"BodyMatches":            bench.BodyMatches(regexp.MustCompile(`"id": \d+`)),
+		"HeaderExists":           bench.HeaderExists("ETag"),
+		"HeaderEquals":           bench.HeaderEquals("Cache-Control", "no-cache"),
+		"JSONPathExists":         bench.JSONPathExists("$.data.items[0]"),
+		"JSONPathExists/not map": bench.JSONPathExists("$.status.code"),
+		"JSONPathEquals":         bench.JSONPathEquals("$.status", "ok"),
+		"JSONPathEquals/invalid": func(resp *http.Response, _ []byte) error {
+			return bench.JSONPathEquals("$.status", "ok")(resp, []byte("<html>"))
+		},
+	}
+	for name, a := range assertions {
+		err := a(resp, body)
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestWithAssertions_ErrorsOnNilAssertion(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithAssertions(nil),
+	)
+	if err == nil {
+		t.Error("want error for nil assertion")
+	}
+}
+
+func TestFromArgs_AssertFlagsErrorOnInvalidAssertion(t *testing.T) {
+	t.Parallel()
+	inputs := [][]string{
+		{"-assert-regex", "("},
+		{"-assert-json", "=ok"},
+		{"-assert-header", ": value"},
+	}
+	for _, args := range inputs {
+		_, err := bench.NewTester(
+			bench.WithStderr(io.Discard),
+			bench.FromArgs(append(args, "-u", "http://fake.url")),
+		)
+		if err == nil {
+			t.Errorf("want error for invalid assertion %q", args)
+		}
+	}
+}
+
+func TestRun_CountsResponsesFailingAssertionsSeparately(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			fmt.Fprint(rw, `{"status": "error"}`)
+			return
+		}
+		fmt.Fprint(rw, `{"status": "ok"}`)
+	}))
+	args := []string{
+		"-r", "4",
+		"-c", "4",
+		"-assert-body", "status",
+		"-assert-regex", `"status":\s*"\w+"`,
+		"-assert-json", "$.status=ok",
+		"-assert-header", "Content-Type: application/json",
+		"-u", server.URL,
+	}
+	tester, err := bench.NewTester(
+		bench.FromArgs(args),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Successes != 3 {
+		t.Errorf("want 3 successes, got %d", stats.Successes)
+	}
+	if stats.Failures != 1 {
+		t.Errorf("want 1 failure, got %d", stats.Failures)
+	}
+	if stats.AssertionFailures != 1 {
+		t.Errorf("want 1 assertion failure, got %d", stats.AssertionFailures)
+	}
+	if len(stats.Errors) != 0 {
+		t.Errorf("want no transport errors, got %v", stats.Errors)
+	}
+}
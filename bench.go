@@ -3,18 +3,24 @@ package bench
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
-	"net/url"
+	"net/http/httptrace"
 	"os"
+	"os/signal"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -32,12 +38,16 @@ const (
 	DefaultOutputPath = "./"
 	// DefaultUserAgent sets the default user agent to be used in the HTTP calls
 	DefaultUserAgent = "Bench 0.0.1 Alpha"
+	// DefaultTimeout sets the default timeout of the HTTP calls
+	DefaultTimeout = 5 * time.Second
 )
 
 var (
-	// DefaultHTTPClient instantiate the http.Client with 5 seconds timeout
+	// DefaultHTTPClient instantiate the http.Client with 5 seconds timeout. It
+	// is not used by Tester, which builds a client of its own unless one is
+	// set with WithHTTPClient
 	DefaultHTTPClient = &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: DefaultTimeout,
 	}
 	// ErrNoArgs is the error for when no arguments is passed via CLI
 	ErrNoArgs = errors.New("no arguments")
@@ -48,6 +58,12 @@ var (
 	// ErrValueCannotBeNil is the error for when the interfaces io.Writer or
 	// io.Reader is nuil
 	ErrValueCannotBeNil = errors.New("value cannot be nil")
+	// ErrConfigWithFlags is the error for when a config file is given along
+	// with other flags
+	ErrConfigWithFlags = errors.New("config file cannot be combined with other flags")
+	// ErrInterrupted is the error for when the run is stopped by a signal
+	// before the end
+	ErrInterrupted = errors.New("run interrupted, stats are incomplete")
 	// ErrUnkownSubCommand is the error for when the subcommand is not known
 	// (run or cmp)
 	ErrUnkownSubCommand = errors.New("unknown subcommand. Please, specify run or cmp")
@@ -55,68 +71,139 @@ var (
 
 // Tester is the main struct where most information are stored
 type Tester struct {
-	body           string
+	assertions     []Assertion
+	body           []byte
 	client         *http.Client
 	concurrency    int
 	contentType    string
+	cookies        bool
+	done           chan struct{}
+	duration       time.Duration
+	endpoints      []*endpoint
 	endAt          time.Duration
+	expectedStatus []string
+	feeder         *DataFeeder
+	flow           bool
 	graphs         bool
+	hashResponses  bool
+	headers        http.Header
 	httpMethod     string
+	keepAlive      bool
 	outputPath     string
+	percentiles    []float64
+	pacing         time.Duration
+	precision      int
+	rate           float64
 	requests       int
+	scenario       []Endpoint
+	seq            int64
+	stages         []Stage
 	startAt        time.Time
+	stdin          io.Reader
+	steps          []Step
+	templating     bool
 	stdout, stderr io.Writer
+	thinkTime      ThinkTime
+	totalWeight    int
+	transport      transportConfig
 	URL            string
 	userAgent      string
 	wg             *sync.WaitGroup
-	work           chan struct{}
+	work           chan time.Time
 
-	mu           *sync.Mutex
-	stats        Stats
-	TimeRecorder TimeRecorder
+	overall        *statsRecorder
+	stageRecorders []*statsRecorder
+	TimeRecorder   TimeRecorder
 }
 
 // NewTester creates a new Tester object, applies functional options and some
 // simple checks on the data passed in, and returns a pointer to Tester and an error
 func NewTester(opts ...Option) (*Tester, error) {
 	tester := &Tester{
-		client:      DefaultHTTPClient,
-		concurrency: DefaultConcurrency,
-		contentType: "text/html",
-		httpMethod:  http.MethodGet,
-		outputPath:  DefaultOutputPath,
-		requests:    DefaultNumRequests,
-		stats:       Stats{},
-		stderr:      os.Stderr,
-		stdout:      os.Stdout,
-		TimeRecorder: TimeRecorder{
-			ExecutionsTime: []float64{},
-			mu:             &sync.Mutex{},
-		},
-		userAgent: DefaultUserAgent,
-		wg:        &sync.WaitGroup{},
-		mu:        &sync.Mutex{},
-	}
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.DisableKeepAlives = true
-	tester.client.Transport = t
+		concurrency:    DefaultConcurrency,
+		contentType:    "text/html",
+		expectedStatus: []string{"200"},
+		httpMethod:     http.MethodGet,
+		outputPath:     DefaultOutputPath,
+		precision:      DefaultHistogramPrecision,
+		requests:       DefaultNumRequests,
+		stdin:          os.Stdin,
+		stderr:         os.Stderr,
+		stdout:         os.Stdout,
+		userAgent:      DefaultUserAgent,
+		wg:             &sync.WaitGroup{},
+	}
 	for _, o := range opts {
 		err := o(tester)
 		if err != nil {
 			return nil, err
 		}
 	}
-	u, err := url.Parse(tester.URL)
-	if err != nil {
-		return nil, err
+	if tester.client != nil && (tester.transport != (transportConfig{}) || tester.keepAlive) {
+		return nil, ErrTransportWithHTTPClient
 	}
-	if u.Host == "" {
-		return nil, fmt.Errorf("invalid URL %q", tester.URL)
+	if tester.client == nil {
+		tester.client = tester.newHTTPClient()
 	}
 	if tester.requests < 1 {
 		return nil, fmt.Errorf("%d is invalid number of requests", tester.requests)
 	}
-	tester.work = make(chan struct{})
+	if tester.duration < 0 {
+		return nil, fmt.Errorf("%s is invalid duration", tester.duration)
+	}
+	if tester.rate < 0 {
+		return nil, fmt.Errorf("%.3f is invalid rate", tester.rate)
+	}
+	if tester.pacing < 0 {
+		return nil, fmt.Errorf("%s is invalid pacing", tester.pacing)
+	}
+	err := tester.thinkTime.validate()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range tester.percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("%v is invalid percentile", p)
+		}
+	}
+	err = validateStatuses(tester.expectedStatus)
+	if err != nil {
+		return nil, err
+	}
+	tester.TimeRecorder, err = NewTimeRecorder(tester.precision)
+	if err != nil {
+		return nil, err
+	}
+	// the overall stats share the histograms of TimeRecorder
+	tester.overall = &statsRecorder{mu: &sync.Mutex{}, TimeRecorder: tester.TimeRecorder}
+	err = tester.buildEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	if len(tester.stages) > 0 {
+		err := validateStages(tester.stages)
+		if err != nil {
+			return nil, err
+		}
+		tester.duration = 0
+		for _, s := range tester.stages {
+			tester.duration += s.Duration
+			tester.stageRecorders = append(tester.stageRecorders, newStatsRecorder(tester.precision))
+		}
+	}
+	if tester.feeder != nil {
+		tester.feeder.workers = tester.concurrency
+		for _, s := range tester.stages {
+			if s.Target > tester.feeder.workers {
+				tester.feeder.workers = s.Target
+			}
+		}
+		if tester.feeder.order == FeedPerWorker && len(tester.feeder.rows) < tester.feeder.workers {
+			return nil, fmt.Errorf("%d data rows cannot be split between %d users", len(tester.feeder.rows), tester.feeder.workers)
+		}
+	}
+	tester.done = make(chan struct{})
+	tester.work = make(chan time.Time)
 	return tester, nil
 }
 
@@ -125,12 +212,83 @@ func FromArgs(args []string) Option {
 	return func(t *Tester) error {
 		fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 		fs.SetOutput(t.stderr)
-		body := fs.String("b", "", "http body for the requests")
+		fs.Func("assert-body", "assert the response body contains the given string (repeatable)", func(s string) error {
+			t.assertions = append(t.assertions, BodyContains(s))
+			return nil
+		})
+		fs.Func("assert-header", "assert the response has the header \"name\" or the header \"name: value\" (repeatable)", func(s string) error {
+			a, err := parseHeaderAssertion(s)
+			if err != nil {
+				return err
+			}
+			t.assertions = append(t.assertions, a)
+			return nil
+		})
+		fs.Func("assert-json", "assert the JSON response body has the path (e.g. $.data[0].id) or the path=value (repeatable)", func(s string) error {
+			a, err := parseJSONAssertion(s)
+			if err != nil {
+				return err
+			}
+			t.assertions = append(t.assertions, a)
+			return nil
+		})
+		fs.Func("assert-regex", "assert the response body matches the given regular expression (repeatable)", func(s string) error {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return err
+			}
+			t.assertions = append(t.assertions, BodyMatches(re))
+			return nil
+		})
+		body := fs.String("b", "", "http body for the requests, @file to read it from a file or @- to read it from stdin")
 		concurrency := fs.Int("c", 1, "number of concurrent requests (users) to run benchmark")
 		contentType := fs.String("t", "text/html", "requests content type header")
+		data := fs.String("data", "", "CSV file, with the column names in the first line, or JSON lines file (.jsonl) whose rows are fed to the requests as {{.Data.column}}. Turns -template on")
+		dataExhausted := fs.String("data-exhausted", FeedLoop, "what to do when the -data rows are exhausted: loop or stop")
+		dataOrder := fs.String("data-order", FeedSequential, "order in which the -data rows are fed: sequential, random or per-worker")
+		duration := fs.Duration("d", 0, "duration of the benchmark (e.g. 30s, 5m). Overrides -r")
+		fs.Func("e", "endpoint of the scenario as \"name[=weight] [method] url\", where url may be a path relative to -u (repeatable)", func(s string) error {
+			e, err := ParseEndpoint(s)
+			if err != nil {
+				return err
+			}
+			return WithEndpoints(e)(t)
+		})
+		configFile := fs.String("f", "", "YAML or JSON config file describing the benchmark. Cannot be combined with other flags")
 		graphs := fs.Bool("g", false, "generate graphs")
+		fs.Func("H", "header for the requests as \"Name: value\", or @file with one header per line (repeatable)", func(s string) error {
+			if strings.HasPrefix(s, "@") {
+				headers, err := ReadHeadersFile(strings.TrimPrefix(s, "@"))
+				if err != nil {
+					return err
+				}
+				return WithHeaders(headers)(t)
+			}
+			name, value, err := parseHeader(s)
+			if err != nil {
+				return err
+			}
+			return WithHeader(name, value)(t)
+		})
+		hash := fs.Bool("hash", false, "hash the response bodies to count the distinct responses")
+		keepAlive := fs.Bool("k", false, "keep connections alive and reuse them between requests")
+		cookies := fs.Bool("cookies", false, "give each user a cookie jar keeping the cookies set by the responses")
 		method := fs.String("m", "GET", "http method for the requests")
+		pacing := fs.Duration("pacing", 0, "time between the starts of two iterations of each user regardless of response times (e.g. 2s)")
+		percentiles := fs.String("p", "", "comma separated list of percentiles to report besides the default ones (e.g. 99.99,25)")
+		rate := fs.Float64("rate", 0, "number of requests per second to send regardless of response times. -c caps the requests in flight")
 		reqs := fs.Int("r", 1, "number of requests to be performed in the benchmark")
+		statuses := fs.String("s", "200", "comma separated list of status codes and classes considered successful (e.g. 200,201,3xx)")
+		stages := fs.String("stages", "", "load profile as comma separated duration:users stages (e.g. 30s:50,2m:50,10s:0) or @file with one stage per line. Overrides -c and -d")
+		fs.Func("think", "pause of each user between iterations: fixed (e.g. 2s), uniform range (e.g. 1s-3s) or exponential around a mean (e.g. exp:2s)", func(s string) error {
+			th, err := ParseThinkTime(s)
+			if err != nil {
+				return err
+			}
+			t.thinkTime = th
+			return nil
+		})
+		templates := fs.Bool("template", false, "evaluate the url, headers and body as Go templates for each request (e.g. /items/{{randInt 1 1000}})")
 		url := fs.String("u", "", "url to run benchmark")
 		if len(args) < 1 {
 			fs.Usage()
@@ -140,14 +298,75 @@ func FromArgs(args []string) Option {
 		if err != nil {
 			return err
 		}
-		t.body = *body
+		if *configFile != "" {
+			if fs.NFlag() > 1 {
+				return ErrConfigWithFlags
+			}
+			return FromConfigFile(*configFile)(t)
+		}
+		switch {
+		case *body == "@-":
+			err = WithBodyReader(t.stdin)(t)
+		case strings.HasPrefix(*body, "@"):
+			t.body, err = os.ReadFile(strings.TrimPrefix(*body, "@"))
+		default:
+			t.body = []byte(*body)
+		}
+		if err != nil {
+			return err
+		}
 		t.concurrency = *concurrency
 		t.contentType = *contentType
+		t.duration = *duration
 		t.graphs = *graphs
+		t.hashResponses = *hash
+		t.keepAlive = *keepAlive
+		t.cookies = *cookies
 		// Standard HTTP verbs must be uppercase
 		t.httpMethod = strings.ToUpper(*method)
+		if *percentiles != "" {
+			for _, field := range strings.Split(*percentiles, ",") {
+				p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil {
+					return fmt.Errorf("invalid percentile %q: %v", field, err)
+				}
+				t.percentiles = append(t.percentiles, p)
+			}
+		}
+		t.pacing = *pacing
+		t.rate = *rate
 		t.requests = *reqs
+		t.templating = *templates
+		if *data != "" {
+			rows, err := ReadDataFile(*data)
+			if err != nil {
+				return err
+			}
+			feeder, err := NewDataFeeder(rows, *dataOrder, *dataExhausted)
+			if err != nil {
+				return err
+			}
+			err = WithDataFeeder(feeder)(t)
+			if err != nil {
+				return err
+			}
+		}
+		t.expectedStatus = strings.Split(*statuses, ",")
+		for i := range t.expectedStatus {
+			t.expectedStatus[i] = strings.TrimSpace(t.expectedStatus[i])
+		}
 		t.URL = *url
+		if *stages != "" {
+			var err error
+			if strings.HasPrefix(*stages, "@") {
+				t.stages, err = ReadStagesFile(strings.TrimPrefix(*stages, "@"))
+			} else {
+				t.stages, err = ParseStages(*stages)
+			}
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 }
@@ -161,6 +380,59 @@ func WithRequests(reqs int) Option {
 	}
 }
 
+// WithExpectedStatus is the functional option to set the status codes
+// considered successful while initializing a new Tester object. Each status
+// is either a code, e.g. 201, or a class of codes, e.g. 2xx. When a
+// redirection is expected, e.g. 302 or 3xx, the client built by the Tester
+// does not follow redirects, so that their status codes are checked
+func WithExpectedStatus(statuses ...string) Option {
+	return func(t *Tester) error {
+		t.expectedStatus = statuses
+		return nil
+	}
+}
+
+// WithDuration is the functional option to set for how long the benchmark
+// should run while initializing a new Tester object. When set, it takes
+// precedence over the number of requests
+func WithDuration(d time.Duration) Option {
+	return func(t *Tester) error {
+		t.duration = d
+		return nil
+	}
+}
+
+// WithRate is the functional option to set the number of requests per second
+// while initializing a new Tester object. With a rate set, requests are sent
+// on a fixed schedule independent of response times, and the concurrency caps
+// how many of them can be in flight at once
+func WithRate(rps float64) Option {
+	return func(t *Tester) error {
+		t.rate = rps
+		return nil
+	}
+}
+
+// WithPercentiles is the functional option to set percentiles, between 0 and
+// 100, to be reported besides the default ones while initializing a new Tester
+// object
+func WithPercentiles(percentiles ...float64) Option {
+	return func(t *Tester) error {
+		t.percentiles = percentiles
+		return nil
+	}
+}
+
+// WithHistogramPrecision is the functional option to set the number of
+// significant decimal digits, between 1 and 5, kept by the latency histograms
+// while initializing a new Tester object. Higher precision uses more memory
+func WithHistogramPrecision(precision int) Option {
+	return func(t *Tester) error {
+		t.precision = precision
+		return nil
+	}
+}
+
 // WithHTTPUserAgent is the functional option to set the HTTP user agent while
 // initializing a new Tester object
 func WithHTTPUserAgent(userAgent string) Option {
@@ -171,9 +443,13 @@ func WithHTTPUserAgent(userAgent string) Option {
 }
 
 // WithHTTPClient is the functional option to set a custom http.Client while
-// initializing a new Tester object
+// initializing a new Tester object. The client is used as it is, so it cannot
+// be combined with the transport options nor with keep-alive
 func WithHTTPClient(client *http.Client) Option {
 	return func(t *Tester) error {
+		if client == nil {
+			return ErrValueCannotBeNil
+		}
 		t.client = client
 		return nil
 	}
@@ -200,6 +476,19 @@ func WithStdout(w io.Writer) Option {
 	}
 }
 
+// WithStdin is the functional option to set a custom io.Reader for stdin
+// while initializing a new Tester object. It must come before FromArgs to be
+// used for reading the body with -b @-
+func WithStdin(r io.Reader) Option {
+	return func(t *Tester) error {
+		if r == nil {
+			return ErrValueCannotBeNil
+		}
+		t.stdin = r
+		return nil
+	}
+}
+
 // WithStderr is the functional option to set a custom io.Writer for stderr
 // while initializing a new Tester object
 func WithStderr(w io.Writer) Option {
@@ -239,6 +528,27 @@ func WithOutputPath(outputPath string) Option {
 	}
 }
 
+// WithKeepAlive is the functional option to set whether connections are kept
+// alive and reused between requests while initializing a new Tester object.
+// By default every request opens a new connection. Like the transport
+// options, it cannot be combined with a custom http.Client
+func WithKeepAlive(keepAlive bool) Option {
+	return func(t *Tester) error {
+		t.keepAlive = keepAlive
+		return nil
+	}
+}
+
+// WithResponseHashes is the functional option to set whether the SHA-256 of
+// the response bodies is computed to count how many distinct responses were
+// received while initializing a new Tester object
+func WithResponseHashes(hash bool) Option {
+	return func(t *Tester) error {
+		t.hashResponses = hash
+		return nil
+	}
+}
+
 // WithGraphs is the functional option to set whether graphs should be generated
 // or not while initializing a new Tester object
 func WithGraphs(graphs bool) Option {
@@ -251,6 +561,33 @@ func WithGraphs(graphs bool) Option {
 // WithBody is the functional option to set the request body
 func WithBody(body string) Option {
 	return func(t *Tester) error {
+		t.body = []byte(body)
+		return nil
+	}
+}
+
+// WithBodyBytes is the functional option to set a request body that may hold
+// binary data. The body is sent as it is in every request, so it must not be
+// modified afterwards
+func WithBodyBytes(body []byte) Option {
+	return func(t *Tester) error {
+		t.body = body
+		return nil
+	}
+}
+
+// WithBodyReader is the functional option to set the request body to the
+// content of r while initializing a new Tester object. r is read only once,
+// and its content is reused by every request
+func WithBodyReader(r io.Reader) Option {
+	return func(t *Tester) error {
+		if r == nil {
+			return ErrValueCannotBeNil
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
 		t.body = body
 		return nil
 	}
@@ -269,11 +606,26 @@ func (t Tester) Concurrency() int {
 	return t.concurrency
 }
 
+// Duration returns the configured duration of the benchmark
+func (t Tester) Duration() time.Duration {
+	return t.duration
+}
+
 // EndAt returns the value that benchmark is done
 func (t Tester) EndAt() int64 {
 	return t.endAt.Milliseconds()
 }
 
+// KeepAlive returns whether connections are kept alive between requests
+func (t Tester) KeepAlive() bool {
+	return t.keepAlive
+}
+
+// ResponseHashes returns whether the response bodies are hashed
+func (t Tester) ResponseHashes() bool {
+	return t.hashResponses
+}
+
 // Graphs returns whether graphs should be generated or not
 func (t Tester) Graphs() bool {
 	return t.graphs
@@ -294,9 +646,20 @@ func (t Tester) OutputPath() string {
 	return t.outputPath
 }
 
+// Percentiles returns the percentiles reported besides the default ones
+func (t Tester) Percentiles() []float64 {
+	return t.percentiles
+}
+
+// Rate returns the configured number of requests per second. Zero means
+// requests are sent as fast as the workers can do them
+func (t Tester) Rate() float64 {
+	return t.rate
+}
+
 // Stats returns the current stats
 func (t Tester) Stats() Stats {
-	return t.stats
+	return t.overall.stats
 }
 
 // Requests returns the current number of requests configured
@@ -311,6 +674,11 @@ func (t Tester) HTTPMethod() string {
 
 // Body returns the current HTTP request body
 func (t Tester) Body() string {
+	return string(t.body)
+}
+
+// BodyBytes returns the current HTTP request body
+func (t Tester) BodyBytes() []byte {
 	return t.body
 }
 
@@ -319,58 +687,187 @@ func (t Tester) ContentType() string {
 	return t.contentType
 }
 
-// DoRequest perform the HTTP request, record the stats and success or failure
+// DoRequest perform the HTTP request, record the stats and success or failure.
+// Besides the time the request took, it records the time since the request was
+// due, which is what a user would have seen if the server stalled while the
+// request was waiting to be sent
 func (t *Tester) DoRequest() {
-	for range t.work {
-		t.RecordRequest()
-		req, err := http.NewRequest(t.httpMethod, t.URL, strings.NewReader(t.body))
-		if err != nil {
-			t.LogStdErr(err.Error())
-			t.RecordFailure()
+	t.doRequests(context.Background(), 0, nil)
+}
+
+// doRequests performs requests until the work channel is closed or quit is
+// closed, whatever happens first. Every unit of work taken from the channel
+// is recorded as a request, or a request per step run with a flow, or as
+// skipped when left without data once the data feeder is exhausted, and a
+// failed request does not stop the worker. With a think time or a pacing, the worker
+// pauses between units of work like a real user.
+// Execution times are recorded locally and merged when it returns, so workers
+// do not wait on each other to record them
+func (t *Tester) doRequests(ctx context.Context, worker int, quit <-chan struct{}) {
+	u := t.newUser(worker)
+	defer t.merge(u.local)
+	var ready time.Time
+	for {
+		select {
+		case <-quit:
 			return
+		case due, ok := <-t.work:
+			if !ok {
+				return
+			}
+			start := time.Now()
+			// without a rate, work queued while the user was pausing was not
+			// due before the user was ready for it
+			if t.rate == 0 && due.Before(ready) {
+				due = ready
+			}
+			t.doRequest(ctx, u, due)
+			if t.pauses() {
+				if !t.pause(ctx, start, quit) {
+					return
+				}
+				ready = time.Now()
+			}
 		}
-		req.Header.Set("user-agent", t.HTTPUserAgent())
-		req.Header.Set("accept", "*/*")
-		req.Header.Set("content-type", t.ContentType())
-		startTime := time.Now()
-		resp, err := t.client.Do(req)
-		elapsedTime := time.Since(startTime)
-		if err != nil {
-			t.LogStdErr(err.Error())
-			t.RecordFailure()
+	}
+}
+
+// doRequest performs the unit of work due at intendedAt: a single request or,
+// with a flow, a request per step until one of them fails
+func (t *Tester) doRequest(ctx context.Context, u *user, intendedAt time.Time) {
+	data := TemplateData{Worker: u.index}
+	if t.feeder != nil {
+		var ok bool
+		data.Data, ok = t.feeder.row(u.index)
+		if !ok {
+			t.overall.recordSkipped()
 			return
 		}
-		t.TimeRecorder.RecordTime(float64(elapsedTime.Nanoseconds()) / 1000000.0)
-		if resp.StatusCode != http.StatusOK {
-			t.LogFStdErr("unexpected status code %d\n", resp.StatusCode)
-			t.RecordFailure()
+	}
+	if !t.flow {
+		t.send(ctx, u, intendedAt, t.pickEndpoint(), data)
+		return
+	}
+	data.Vars = map[string]string{}
+	for _, e := range t.endpoints {
+		if !t.send(ctx, u, intendedAt, e, data) {
 			return
 		}
-		t.RecordSuccess()
+		intendedAt = time.Now()
+	}
+}
+
+// send performs a single request to e due at intendedAt, records its outcome
+// and stores the values extracted from its response into data.Vars. It
+// returns whether the request was successful
+func (t *Tester) send(ctx context.Context, u *user, intendedAt time.Time, e *endpoint, data TemplateData) bool {
+	rec := recorders{t.overall, t.stageRecorder(time.Since(t.startAt)), e.recorder}
+	rec.recordRequest()
+	data.Seq = atomic.AddInt64(&t.seq, 1) - 1
+	target, reqBody, headers, err := e.request(data)
+	var req *http.Request
+	if err == nil {
+		req, err = http.NewRequestWithContext(ctx, e.method, target, bytes.NewReader(reqBody))
+	}
+	if err != nil {
+		return t.fail(rec, err)
+	}
+	t.setHeaders(req, headers)
+	timer := &phaseTimer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+	startTime := time.Now()
+	resp, err := u.client.Do(req)
+	elapsedTime := time.Since(startTime)
+	if err != nil {
+		return t.fail(rec, canceled(ctx, err))
+	}
+	executionTime := float64(elapsedTime.Nanoseconds()) / 1000000.0
+	correctedTime := float64(time.Since(intendedAt).Nanoseconds()) / 1000000.0
+	u.local.record(rec, executionTime, correctedTime)
+	body := &bytes.Buffer{}
+	hash := sha256.New()
+	writers := []io.Writer{io.Discard}
+	if len(t.assertions) > 0 || len(e.extractors) > 0 {
+		writers = append(writers, body)
+	}
+	if t.hashResponses {
+		writers = append(writers, hash)
+	}
+	received, err := io.Copy(io.MultiWriter(writers...), resp.Body)
+	resp.Body.Close()
+	timer.stamp(&timer.transferDone)
+	u.local.recordPhases(rec, timer.durations())
+	rec.recordTransfer(int64(len(reqBody)), received)
+	rec.recordStatus(resp.StatusCode)
+	if u.startsSession(req) {
+		rec.recordSession()
+	}
+	if err != nil {
+		return t.fail(rec, canceled(ctx, err))
+	}
+	if t.hashResponses {
+		var sum [sha256.Size]byte
+		copy(sum[:], hash.Sum(nil))
+		rec.recordResponseHash(sum)
+	}
+	if !t.isExpectedStatus(resp.StatusCode) {
+		return t.fail(rec, statusError(resp.StatusCode))
+	}
+	err = t.assert(resp, body.Bytes())
+	if err != nil {
+		return t.fail(rec, assertionError{err})
+	}
+	// a value that cannot be extracted fails the response like an assertion
+	err = e.extract(resp, body.Bytes(), data.Vars)
+	if err != nil {
+		return t.fail(rec, assertionError{err})
 	}
+	rec.recordSuccess()
+	return true
+}
+
+// fail logs err and records the request failing with it. It always returns
+// false, for send to return it
+func (t *Tester) fail(rec recorders, err error) bool {
+	t.logf("%v\n", err)
+	rec.recordFailure(err)
+	return false
 }
 
 // Run orchestrates the main program and go routines
 func (t *Tester) Run() error {
-	t.wg.Add(t.Concurrency())
-	go func() {
-		for x := 0; x < t.Requests(); x++ {
-			t.work <- struct{}{}
-		}
-		close(t.work)
-	}()
+	return t.RunContext(context.Background())
+}
+
+// RunContext runs the benchmark like Run until ctx is done. When ctx is done
+// before the benchmark ends, no more requests are sent, the outstanding ones
+// are canceled and, once all workers have returned, the stats of what was
+// completed are reported marked as incomplete along with the error of ctx
+func (t *Tester) RunContext(ctx context.Context) error {
 	t.startAt = time.Now()
-	go func() {
-		for x := 0; x < t.Concurrency(); x++ {
-			go func() {
-				t.DoRequest()
-				t.wg.Done()
-			}()
-		}
-	}()
+	go t.dispatch(ctx)
+	if len(t.stages) > 0 {
+		t.wg.Add(1)
+		go t.runStages(ctx)
+	} else {
+		t.wg.Add(t.concurrency)
+		go func() {
+			for x := 0; x < t.concurrency; x++ {
+				go func(worker int) {
+					t.doRequests(ctx, worker, nil)
+					t.wg.Done()
+				}(x)
+			}
+		}()
+	}
 	t.wg.Wait()
 	t.endAt = time.Since(t.startAt)
+	t.overall.stats.Incomplete = ctx.Err() != nil
+	calculateThroughput(&t.overall.stats, t.endAt, t.overall.responses)
 	t.CalculatePercentiles()
+	t.calculateStages()
+	t.calculateEndpoints()
+	fmt.Fprintln(t.stdout, t.overall.stats)
 	if t.Graphs() {
 		err := t.Boxplot()
 		if err != nil {
@@ -380,9 +877,95 @@ func (t *Tester) Run() error {
 		if err != nil {
 			return err
 		}
+		err = t.PhasesGraph()
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// dispatch feeds the work channel with the time each unit of work is due until
+// the number of requests or the duration is reached, the data feeder is
+// exhausted, or ctx is done. With a rate set, each unit of work is due at a
+// fixed interval from the start, and the ones that could only be handed to a
+// worker after the next one was already due are recorded as late, while the
+// ones already due but never handed to a worker when the duration elapses or
+// ctx is done are recorded as dropped. Without a rate, a unit of work is due as
+// soon as it is queued
+func (t *Tester) dispatch(ctx context.Context) {
+	defer close(t.done)
+	defer close(t.work)
+	start := time.Now()
+	var deadline <-chan time.Time
+	if t.duration > 0 {
+		timer := time.NewTimer(t.duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var interval time.Duration
+	if t.rate > 0 {
+		interval = time.Duration(float64(time.Second) / t.rate)
+	}
+	var exhausted <-chan struct{}
+	if t.feeder != nil {
+		exhausted = t.feeder.done
+	}
+	for x := 0; t.duration > 0 || x < t.requests; x++ {
+		due := start.Add(time.Duration(x) * interval)
+		if t.duration > 0 && due.Sub(start) >= t.duration {
+			return
+		}
+		wait := time.NewTimer(time.Until(due))
+		select {
+		case <-wait.C:
+		case <-exhausted:
+			wait.Stop()
+			return
+		case <-ctx.Done():
+			wait.Stop()
+			t.recordDropped(start, interval, x)
+			return
+		}
+		if interval == 0 {
+			due = time.Now()
+		}
+		select {
+		case t.work <- due:
+		case <-deadline:
+			t.recordDropped(start, interval, x)
+			return
+		case <-exhausted:
+			return
+		case <-ctx.Done():
+			t.recordDropped(start, interval, x)
+			return
+		}
+		if interval > 0 && time.Since(due) > interval {
+			t.RecordLate()
+		}
+	}
+}
+
+// recordDropped records the units of work due on the schedule of a rate by the
+// time the run ended or was stopped, and never handed to a worker, as sent of
+// them were
+func (t *Tester) recordDropped(start time.Time, interval time.Duration, sent int) {
+	if interval == 0 {
+		return
+	}
+	due := int(time.Since(start)/interval) + 1
+	if t.duration > 0 {
+		// the last unit of work is due before the duration elapses
+		if last := int((t.duration-1)/interval) + 1; due > last {
+			due = last
+		}
+	} else if due > t.requests {
+		due = t.requests
+	}
+	if due > sent {
+		t.overall.recordDropped(due - sent)
 	}
-	fmt.Fprintln(t.stdout, t.stats)
-	return nil
 }
 
 // Boxplot generates a boxplot graph
@@ -392,7 +975,7 @@ func (t Tester) Boxplot() error {
 	p.Y.Label.Text = "latency (ms)"
 	p.X.Label.Text = t.URL
 	w := vg.Points(20)
-	box, err := plotter.NewBoxPlot(w, 0, plotter.Values(t.TimeRecorder.ExecutionsTime))
+	box, err := histogramBoxPlot(w, t.TimeRecorder.ExecutionsTime)
 	if err != nil {
 		return err
 	}
@@ -404,13 +987,56 @@ func (t Tester) Boxplot() error {
 	return nil
 }
 
+// histogramBoxPlot creates a boxplot of the values recorded in h. The box is
+// drawn from the histogram percentiles, while the outside points are the
+// lowest values of the buckets beyond the whiskers
+func histogramBoxPlot(w vg.Length, h *Histogram) (*plotter.BoxPlot, error) {
+	if h.TotalCount() == 0 {
+		return nil, ErrTimeNotRecorded
+	}
+	values := plotter.Values{}
+	h.forEach(func(v, count int64) {
+		values = append(values, float64(v)/1000)
+	})
+	box, err := plotter.NewBoxPlot(w, 0, values)
+	if err != nil {
+		return nil, err
+	}
+	box.Median = h.ValueAtPercentile(50)
+	box.Quartile1 = h.ValueAtPercentile(25)
+	box.Quartile3 = h.ValueAtPercentile(75)
+	box.Min = h.Min()
+	box.Max = h.Max()
+	low := box.Quartile1 - 1.5*(box.Quartile3-box.Quartile1)
+	high := box.Quartile3 + 1.5*(box.Quartile3-box.Quartile1)
+	box.AdjLow = math.Inf(1)
+	box.AdjHigh = math.Inf(-1)
+	box.Outside = nil
+	for i, v := range box.Values {
+		if v > high || v < low {
+			box.Outside = append(box.Outside, i)
+			continue
+		}
+		box.AdjLow = math.Min(box.AdjLow, v)
+		box.AdjHigh = math.Max(box.AdjHigh, v)
+	}
+	return box, nil
+}
+
 // Histogram generates a histogram graph
 func (t Tester) Histogram() error {
 	p := plot.New()
 	p.Title.Text = "Latency Histogram"
 	p.Y.Label.Text = "n reqs"
 	p.X.Label.Text = "latency (ms)"
-	hist, err := plotter.NewHist(plotter.Values(t.TimeRecorder.ExecutionsTime), 50)
+	if t.TimeRecorder.ExecutionsTime.TotalCount() == 0 {
+		return ErrTimeNotRecorded
+	}
+	counts := plotter.XYs{}
+	t.TimeRecorder.ExecutionsTime.forEach(func(v, count int64) {
+		counts = append(counts, plotter.XY{X: float64(v) / 1000, Y: float64(count)})
+	})
+	hist, err := plotter.NewHistogram(counts, 50)
 	if err != nil {
 		return err
 	}
@@ -424,23 +1050,22 @@ func (t Tester) Histogram() error {
 
 // RecordRequest uses mutex to increment one in the total requests
 func (t *Tester) RecordRequest() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.stats.Requests++
+	t.overall.recordRequest()
 }
 
 // RecordSuccess uses mutex to increment one in the total successes
 func (t *Tester) RecordSuccess() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.stats.Successes++
+	t.overall.recordSuccess()
 }
 
 // RecordFailure uses mutex to increment one in the total failures
 func (t *Tester) RecordFailure() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.stats.Failures++
+	t.overall.recordFailure(nil)
+}
+
+// RecordLate uses mutex to increment one in the total of late requests
+func (t *Tester) RecordLate() {
+	t.overall.recordLate()
 }
 
 // LogStdOut is a wrapper to avoid Fprint to t.stdout in several places.
@@ -463,59 +1088,382 @@ func (t Tester) LogFStdErr(msg string, opts ...interface{}) {
 	fmt.Fprintf(t.stderr, msg, opts...)
 }
 
+// logf is LogFStdErr for the workers and the signal handler, which must not
+// copy the Tester while others record into it
+func (t *Tester) logf(msg string, opts ...interface{}) {
+	fmt.Fprintf(t.stderr, msg, opts...)
+}
+
 // CalculatePercentiles check if there is time recorded, calculates p50, p90 and
-// p99 metrics plus the total time for all executions
+// p99 metrics for both the raw and the coordinated omission corrected
+// execution times
 func (t *Tester) CalculatePercentiles() {
-	times := t.TimeRecorder.ExecutionsTime
-	if len(times) < 1 {
+	if t.TimeRecorder.ExecutionsTime.TotalCount() < 1 {
 		return
 	}
-	sort.Slice(times, func(i, j int) bool {
-		return times[i] < times[j]
-	})
-	p50Idx := int(math.Round(float64(len(times))*0.5)) - 1
-	t.stats.P50 = times[p50Idx]
-	p90Idx := int(math.Round(float64(len(times))*0.9)) - 1
-	t.stats.P90 = times[p90Idx]
-	p99Idx := int(math.Round(float64(len(times))*0.99)) - 1
-	t.stats.P99 = times[p99Idx]
-	t.stats.URL = t.URL
+	calculatePercentiles(t.TimeRecorder, &t.overall.stats, t.percentiles)
+	t.overall.stats.URL = t.URL
+}
+
+// calculateThroughput sets the elapsed time, the rates of requests and the
+// mean size of the responses to the given stats
+func calculateThroughput(stats *Stats, elapsed time.Duration, responses int) {
+	stats.Elapsed = float64(elapsed.Nanoseconds()) / 1000000.0
+	if elapsed > 0 {
+		stats.RPS = float64(stats.Requests) / elapsed.Seconds()
+		stats.SuccessRPS = float64(stats.Successes) / elapsed.Seconds()
+	}
+	if responses > 0 {
+		stats.MeanResponseSize = float64(stats.BytesReceived) / float64(responses)
+	}
+}
+
+// calculatePercentiles sets the summary statistics and the percentiles of the
+// execution times recorded in tr to the given stats, including the extra
+// percentiles not reported by default
+func calculatePercentiles(tr TimeRecorder, stats *Stats, extra []float64) {
+	times := tr.ExecutionsTime
+	stats.Min = times.Min()
+	stats.Mean = times.Mean()
+	stats.StdDev = times.StdDev()
+	stats.Max = times.Max()
+	stats.P50 = times.ValueAtPercentile(50)
+	stats.P75 = times.ValueAtPercentile(75)
+	stats.P90 = times.ValueAtPercentile(90)
+	stats.P95 = times.ValueAtPercentile(95)
+	stats.P99 = times.ValueAtPercentile(99)
+	stats.P999 = times.ValueAtPercentile(99.9)
+	corrected := tr.CorrectedExecutionsTime
+	for _, p := range extra {
+		if defaultPercentiles[p] {
+			continue
+		}
+		if stats.Percentiles == nil {
+			stats.Percentiles = map[float64]float64{}
+			stats.CorrectedPercentiles = map[float64]float64{}
+		}
+		stats.Percentiles[p] = times.ValueAtPercentile(p)
+		stats.CorrectedPercentiles[p] = corrected.ValueAtPercentile(p)
+	}
+	stats.CorrectedP50 = corrected.ValueAtPercentile(50)
+	stats.CorrectedP75 = corrected.ValueAtPercentile(75)
+	stats.CorrectedP90 = corrected.ValueAtPercentile(90)
+	stats.CorrectedP95 = corrected.ValueAtPercentile(95)
+	stats.CorrectedP99 = corrected.ValueAtPercentile(99)
+	stats.CorrectedP999 = corrected.ValueAtPercentile(99.9)
+	calculatePhases(tr, stats)
 }
 
-// Stats is the struct to store statistical information about the benchmark
+// defaultPercentiles are the percentiles always reported in Stats
+var defaultPercentiles = map[float64]bool{50: true, 75: true, 90: true, 95: true, 99: true, 99.9: true}
+
+// Stats is the struct to store statistical information about the benchmark.
+// Incomplete is set when the benchmark was stopped before the end.
+// Percentiles holds the percentiles requested besides the ones always
+// reported, and CorrectedPercentiles their coordinated omission corrected
+// values. Bytes sent and received account for the bodies of the requests
+// that got a response. StatusCodes counts the responses by status code, and
+// Errors counts the requests that failed without a valid response by error
+// category. DistinctResponses counts the different response bodies received
+// when they are hashed. Sessions counts the users receiving cookies when
+// cookies are on. Dropped counts the units of work due on the schedule of a
+// rate that were never sent, as the run ended or was stopped while all users
+// were busy. Skipped counts the units of work left without data once the data
+// feeder was exhausted. AssertionFailures counts the failures of
+// responses with an expected status code not passing the assertions, or
+// missing a value to extract in a flow. Phases holds the stats of each phase
+// of the requests, keyed by the phase name. Endpoints holds the stats of the
+// requests to each endpoint of a scenario, or to each step of a flow, keyed by
+// name
 type Stats struct {
-	URL       string
-	P50       float64
-	P90       float64
-	P99       float64
-	Failures  int
-	Requests  int
-	Successes int
+	URL                  string
+	Incomplete           bool
+	Min                  float64
+	Mean                 float64
+	StdDev               float64
+	Max                  float64
+	P50                  float64
+	P75                  float64
+	P90                  float64
+	P95                  float64
+	P99                  float64
+	P999                 float64
+	Percentiles          map[float64]float64
+	CorrectedP50         float64
+	CorrectedP75         float64
+	CorrectedP90         float64
+	CorrectedP95         float64
+	CorrectedP99         float64
+	CorrectedP999        float64
+	CorrectedPercentiles map[float64]float64
+	Phases               map[string]PhaseStats
+	Elapsed              float64
+	RPS                  float64
+	SuccessRPS           float64
+	BytesSent            int64
+	BytesReceived        int64
+	MeanResponseSize     float64
+	DistinctResponses    int
+	Sessions             int
+	Failures             int
+	AssertionFailures    int
+	StatusCodes          map[int]int
+	Errors               map[string]int
+	Late                 int
+	Dropped              int
+	Skipped              int
+	Requests             int
+	Successes            int
+	Stages               []Stats
+	Endpoints            map[string]Stats
 }
 
-// String returns printable string of the stats
+// String returns printable string of the stats followed by the stats of each
+// stage and each endpoint, if any
 func (s Stats) String() string {
-	return fmt.Sprintf(`Site: %s
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `Site: %s%s
 Requests: %d
 Successes: %d
 Failures: %d
+AssertionFailures: %d%s
+Late: %d%s
+Elapsed(ms): %.3f
+RPS: %.3f
+SuccessRPS: %.3f
+BytesSent: %d
+BytesReceived: %d
+MeanResponseSize(bytes): %.3f%s
+Min(ms): %.3f
+Mean(ms): %.3f
+StdDev(ms): %.3f
+Max(ms): %.3f
 P50(ms): %.3f
+P75(ms): %.3f
 P90(ms): %.3f
-P99(ms): %.3f`, s.URL, s.Requests, s.Successes, s.Failures, s.P50, s.P90, s.P99,
+P95(ms): %.3f
+P99(ms): %.3f
+P99.9(ms): %.3f`, s.URL, incompleteString(s), s.Requests, s.Successes, s.Failures, s.AssertionFailures, failuresString(s), s.Late, droppedString(s)+skippedString(s), s.Elapsed, s.RPS,
+		s.SuccessRPS, s.BytesSent, s.BytesReceived, s.MeanResponseSize, distinctResponsesString(s)+sessionsString(s),
+		s.Min, s.Mean, s.StdDev, s.Max, s.P50, s.P75, s.P90, s.P95, s.P99, s.P999,
 	)
+	for _, p := range sortedPercentiles(s.Percentiles) {
+		fmt.Fprintf(buf, "\n%s: %.3f", percentileName(p), s.Percentiles[p])
+	}
+	fmt.Fprintf(buf, `
+CorrectedP50(ms): %.3f
+CorrectedP75(ms): %.3f
+CorrectedP90(ms): %.3f
+CorrectedP95(ms): %.3f
+CorrectedP99(ms): %.3f
+CorrectedP99.9(ms): %.3f`, s.CorrectedP50, s.CorrectedP75, s.CorrectedP90, s.CorrectedP95, s.CorrectedP99, s.CorrectedP999)
+	for _, p := range sortedPercentiles(s.CorrectedPercentiles) {
+		fmt.Fprintf(buf, "\n%s: %.3f", correctedPercentileName(p), s.CorrectedPercentiles[p])
+	}
+	buf.WriteString(phasesString(s))
+	for i, stage := range s.Stages {
+		fmt.Fprintf(buf, "\n\nStage: %d\n%s", i+1, stage)
+	}
+	buf.WriteString(endpointsString(s))
+	return buf.String()
 }
 
-// TimeRecorder is the struct to store all execution times
+// incompleteString returns the line flagging the stats of a run stopped
+// before the end, only present when it was
+func incompleteString(s Stats) string {
+	if !s.Incomplete {
+		return ""
+	}
+	return "\nIncomplete: true"
+}
+
+// distinctResponsesString returns the line of the distinct responses, only
+// present when the response bodies were hashed
+func distinctResponsesString(s Stats) string {
+	if s.DistinctResponses == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nDistinctResponses: %d", s.DistinctResponses)
+}
+
+// droppedString returns the line of the dropped units of work, only present
+// when some were
+func droppedString(s Stats) string {
+	if s.Dropped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nDropped: %d", s.Dropped)
+}
+
+// percentileName returns how a percentile is named in the stats, e.g.
+// P99.99(ms)
+func percentileName(p float64) string {
+	return fmt.Sprintf("P%s(ms)", strconv.FormatFloat(p, 'f', -1, 64))
+}
+
+// correctedPercentileName returns how the coordinated omission corrected value
+// of a percentile is named in the stats, e.g. CorrectedP99.99(ms)
+func correctedPercentileName(p float64) string {
+	return "Corrected" + percentileName(p)
+}
+
+// parsePercentileName returns the percentile named by name, as returned by
+// percentileName, and whether name is a percentile name at all
+func parsePercentileName(name string) (float64, bool) {
+	if !strings.HasPrefix(name, "P") || !strings.HasSuffix(name, "(ms)") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(name, "P"), "(ms)"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return p, true
+}
+
+// sortedPercentiles returns the percentiles of the map in ascending order
+func sortedPercentiles(percentiles map[float64]float64) []float64 {
+	ps := make([]float64, 0, len(percentiles))
+	for p := range percentiles {
+		ps = append(ps, p)
+	}
+	sort.Float64s(ps)
+	return ps
+}
+
+// TimeRecorder is the struct to store all execution times. Corrected
+// execution times are measured from when the request was due rather than from
+// when it was sent. PhasesTime holds the durations of each phase of the
+// requests, keyed by the phase name
 type TimeRecorder struct {
-	mu             *sync.Mutex
-	ExecutionsTime []float64
+	mu                      *sync.Mutex
+	ExecutionsTime          *Histogram
+	CorrectedExecutionsTime *Histogram
+	PhasesTime              map[string]*Histogram
 }
 
-// RecordTime uses mutex to add new execution time in the slice of execution times
+// NewTimeRecorder creates a TimeRecorder whose histograms keep the given
+// number of significant decimal digits
+func NewTimeRecorder(precision int) (TimeRecorder, error) {
+	_, err := NewHistogram(precision)
+	if err != nil {
+		return TimeRecorder{}, err
+	}
+	return newTimeRecorder(precision), nil
+}
+
+func newTimeRecorder(precision int) TimeRecorder {
+	times, _ := NewHistogram(precision)
+	corrected, _ := NewHistogram(precision)
+	phasesTime := map[string]*Histogram{}
+	for _, phase := range phases {
+		phasesTime[phase], _ = NewHistogram(precision)
+	}
+	return TimeRecorder{
+		mu:                      &sync.Mutex{},
+		ExecutionsTime:          times,
+		CorrectedExecutionsTime: corrected,
+		PhasesTime:              phasesTime,
+	}
+}
+
+// RecordTime uses mutex to add new execution time in the histogram of execution times
 func (t *TimeRecorder) RecordTime(executionTime float64) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	t.ExecutionsTime = append(t.ExecutionsTime, executionTime)
+	t.ExecutionsTime.RecordValue(executionTime)
+}
+
+// RecordCorrectedTime uses mutex to add new corrected execution time in the
+// histogram of corrected execution times
+func (t *TimeRecorder) RecordCorrectedTime(executionTime float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.CorrectedExecutionsTime.RecordValue(executionTime)
+}
+
+// Merge uses mutex to add all execution times recorded in other
+func (t *TimeRecorder) Merge(other TimeRecorder) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ExecutionsTime.Merge(other.ExecutionsTime)
+	t.CorrectedExecutionsTime.Merge(other.CorrectedExecutionsTime)
+	for phase, times := range other.PhasesTime {
+		t.PhasesTime[phase].Merge(times)
+	}
+}
+
+// user is the state of a worker sending requests: its index, the execution
+// times it recorded and the client it sends requests with, which has a cookie
+// jar of its own when cookies are on
+type user struct {
+	index   int
+	local   *localRecorder
+	client  *http.Client
+	session bool
+}
+
+func (t *Tester) newUser(index int) *user {
+	return &user{
+		index:  index,
+		local:  t.newLocalRecorder(),
+		client: t.userClient(),
+	}
+}
+
+// localRecorder holds the execution times recorded by a single worker, overall
+// and per stage and endpoint, without any locking
+type localRecorder struct {
+	precision int
+	parts     map[*statsRecorder]TimeRecorder
+}
+
+func (t *Tester) newLocalRecorder() *localRecorder {
+	return &localRecorder{
+		precision: t.precision,
+		parts:     map[*statsRecorder]TimeRecorder{},
+	}
+}
+
+// part returns the execution times recorded for the given statsRecorder
+func (l *localRecorder) part(s *statsRecorder) TimeRecorder {
+	times, ok := l.parts[s]
+	if !ok {
+		times = newTimeRecorder(l.precision)
+		l.parts[s] = times
+	}
+	return times
+}
+
+func (l *localRecorder) record(rs recorders, executionTime, correctedTime float64) {
+	for _, s := range rs {
+		if s == nil {
+			continue
+		}
+		times := l.part(s)
+		times.ExecutionsTime.RecordValue(executionTime)
+		times.CorrectedExecutionsTime.RecordValue(correctedTime)
+	}
+}
+
+// recordPhases records how long each phase of a request took for each of the
+// given recorders
+func (l *localRecorder) recordPhases(rs recorders, durations map[string]float64) {
+	for _, s := range rs {
+		if s == nil {
+			continue
+		}
+		times := l.part(s)
+		for phase, d := range durations {
+			times.PhasesTime[phase].RecordValue(d)
+		}
+	}
+}
+
+// merge adds the execution times recorded by a worker to the Tester
+func (t *Tester) merge(l *localRecorder) {
+	for s, times := range l.parts {
+		s.TimeRecorder.Merge(times)
+	}
 }
 
 // Option is a type for functional options
@@ -536,65 +1484,279 @@ func ReadStatsFile(path string) (Stats, error) {
 	return stats, nil
 }
 
-// ReadStats reads the stats of a given io.Reader and returns the stats and an error
+// ReadStats reads the stats of a given io.Reader and returns the stats and an
+// error. Fields following a Stage or an Endpoint line belong to that stage or
+// endpoint
 func ReadStats(r io.Reader) (Stats, error) {
 	scanner := bufio.NewScanner(r)
 	stats := Stats{}
+	cur := &stats
+	endpoints := map[string]*Stats{}
 	for scanner.Scan() {
 		text := scanner.Text()
-		pos := strings.Split(text, " ")
+		// values such as templated URLs may hold spaces
+		pos := strings.SplitN(text, " ", 2)
 		if len(pos) < 2 {
 			continue
 		}
 		field := pos[0]
 		value := pos[1]
 		switch field {
+		case "Stage:":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			if n != len(stats.Stages)+1 {
+				return Stats{}, fmt.Errorf("unexpected stage %d, want %d", n, len(stats.Stages)+1)
+			}
+			stats.Stages = append(stats.Stages, Stats{})
+			cur = &stats.Stages[n-1]
+		case "Endpoint:":
+			if endpoints[value] != nil {
+				return Stats{}, fmt.Errorf("duplicate endpoint %q", value)
+			}
+			cur = &Stats{}
+			endpoints[value] = cur
 		case "Site:":
-			stats.URL = value
+			cur.URL = value
+		case "Incomplete:":
+			valueConv, err := strconv.ParseBool(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Incomplete = valueConv
 		case "Requests:":
 			valueConv, err := strconv.Atoi(value)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.Requests = valueConv
+			cur.Requests = valueConv
 		case "Successes:":
 			valueConv, err := strconv.Atoi(value)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.Successes = valueConv
+			cur.Successes = valueConv
 		case "Failures:":
 			valueConv, err := strconv.Atoi(value)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.Failures = valueConv
+			cur.Failures = valueConv
+		case "DistinctResponses:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.DistinctResponses = valueConv
+		case "Sessions:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Sessions = valueConv
+		case "AssertionFailures:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.AssertionFailures = valueConv
+		case "Late:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Late = valueConv
+		case "Dropped:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Dropped = valueConv
+		case "Skipped:":
+			valueConv, err := strconv.Atoi(value)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Skipped = valueConv
+		case "Elapsed(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Elapsed = valueConv
+		case "RPS:":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.RPS = valueConv
+		case "SuccessRPS:":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.SuccessRPS = valueConv
+		case "BytesSent:":
+			valueConv, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.BytesSent = valueConv
+		case "BytesReceived:":
+			valueConv, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.BytesReceived = valueConv
+		case "MeanResponseSize(bytes):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.MeanResponseSize = valueConv
+		case "Min(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Min = valueConv
+		case "Mean(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Mean = valueConv
+		case "StdDev(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.StdDev = valueConv
+		case "Max(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.Max = valueConv
 		case "P50(ms):":
 			valueConv, err := strconv.ParseFloat(value, 64)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.P50 = valueConv
+			cur.P50 = valueConv
+		case "P75(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.P75 = valueConv
 		case "P90(ms):":
 			valueConv, err := strconv.ParseFloat(value, 64)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.P90 = valueConv
+			cur.P90 = valueConv
+		case "P95(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.P95 = valueConv
 		case "P99(ms):":
 			valueConv, err := strconv.ParseFloat(value, 64)
 			if err != nil {
 				return Stats{}, err
 			}
-			stats.P99 = valueConv
+			cur.P99 = valueConv
+		case "P99.9(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.P999 = valueConv
+		case "CorrectedP50(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP50 = valueConv
+		case "CorrectedP75(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP75 = valueConv
+		case "CorrectedP90(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP90 = valueConv
+		case "CorrectedP95(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP95 = valueConv
+		case "CorrectedP99(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP99 = valueConv
+		case "CorrectedP99.9(ms):":
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			cur.CorrectedP999 = valueConv
 		default:
-			return Stats{}, fmt.Errorf("unknown statsfile format. Invalid line %q", text)
+			ok, err := readPhaseLine(cur, field, value)
+			if err != nil {
+				return Stats{}, err
+			}
+			if ok {
+				continue
+			}
+			ok, err = readFailureLine(cur, field, value)
+			if err != nil {
+				return Stats{}, err
+			}
+			if ok {
+				continue
+			}
+			name := strings.TrimSuffix(field, ":")
+			percentiles := &cur.Percentiles
+			if strings.HasPrefix(name, "Corrected") {
+				name = strings.TrimPrefix(name, "Corrected")
+				percentiles = &cur.CorrectedPercentiles
+			}
+			p, ok := parsePercentileName(name)
+			if !ok {
+				return Stats{}, fmt.Errorf("unknown statsfile format. Invalid line %q", text)
+			}
+			valueConv, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, err
+			}
+			if *percentiles == nil {
+				*percentiles = map[float64]float64{}
+			}
+			(*percentiles)[p] = valueConv
 		}
 
 	}
 	if err := scanner.Err(); err != nil {
 		return Stats{}, err
 	}
+	for name, e := range endpoints {
+		if stats.Endpoints == nil {
+			stats.Endpoints = map[string]Stats{}
+		}
+		stats.Endpoints[name] = *e
+	}
 	return stats, nil
 }
 
@@ -603,18 +1765,62 @@ type CompareStats struct {
 	S1, S2 Stats
 }
 
-// String returns a printable string from comparison of two stats.
+// String returns a printable string from comparison of two stats. Metrics
+// missing from both stats, e.g. read from files written by older versions,
+// are left out
 func (cs CompareStats) String() string {
 	buf := &bytes.Buffer{}
 	fmt.Fprintf(buf, "Site: %s\n", cs.S1.URL)
 	writer := tabwriter.NewWriter(buf, 20, 0, 0, ' ', 0)
 	fmt.Fprintln(writer, "Metric\tOld\tNew\tDelta\tPercentage")
-	p50Delta := cs.S2.P50 - cs.S1.P50
-	fmt.Fprintf(writer, "P50(ms)\t%.3f\t%.3f\t%.3f\t%.2f\n", cs.S1.P50, cs.S2.P50, p50Delta, p50Delta/cs.S1.P50*100)
-	p90Delta := cs.S2.P90 - cs.S1.P90
-	fmt.Fprintf(writer, "P90(ms)\t%.3f\t%.3f\t%.3f\t%.2f\n", cs.S1.P90, cs.S2.P90, p90Delta, p90Delta/cs.S1.P90*100)
-	p99Delta := cs.S2.P99 - cs.S1.P99
-	fmt.Fprintf(writer, "P99(ms)\t%.3f\t%.3f\t%.3f\t%.2f\n", cs.S1.P99, cs.S2.P99, p99Delta, p99Delta/cs.S1.P99*100)
+	row := func(metric string, old, new float64) {
+		if old == 0 && new == 0 {
+			return
+		}
+		delta := new - old
+		fmt.Fprintf(writer, "%s\t%.3f\t%.3f\t%.3f\t%.2f\n", metric, old, new, delta, delta/old*100)
+	}
+	row("RPS", cs.S1.RPS, cs.S2.RPS)
+	row("SuccessRPS", cs.S1.SuccessRPS, cs.S2.SuccessRPS)
+	row("BytesSent", float64(cs.S1.BytesSent), float64(cs.S2.BytesSent))
+	row("BytesReceived", float64(cs.S1.BytesReceived), float64(cs.S2.BytesReceived))
+	row("MeanRespSize(bytes)", cs.S1.MeanResponseSize, cs.S2.MeanResponseSize)
+	row("Min(ms)", cs.S1.Min, cs.S2.Min)
+	row("Mean(ms)", cs.S1.Mean, cs.S2.Mean)
+	row("StdDev(ms)", cs.S1.StdDev, cs.S2.StdDev)
+	row("Max(ms)", cs.S1.Max, cs.S2.Max)
+	row("P50(ms)", cs.S1.P50, cs.S2.P50)
+	row("P75(ms)", cs.S1.P75, cs.S2.P75)
+	row("P90(ms)", cs.S1.P90, cs.S2.P90)
+	row("P95(ms)", cs.S1.P95, cs.S2.P95)
+	row("P99(ms)", cs.S1.P99, cs.S2.P99)
+	row("P99.9(ms)", cs.S1.P999, cs.S2.P999)
+	percentiles := map[float64]float64{}
+	for p := range cs.S1.Percentiles {
+		percentiles[p] = 0
+	}
+	for p := range cs.S2.Percentiles {
+		percentiles[p] = 0
+	}
+	for _, p := range sortedPercentiles(percentiles) {
+		row(percentileName(p), cs.S1.Percentiles[p], cs.S2.Percentiles[p])
+	}
+	row("CorrectedP50(ms)", cs.S1.CorrectedP50, cs.S2.CorrectedP50)
+	row("CorrectedP75(ms)", cs.S1.CorrectedP75, cs.S2.CorrectedP75)
+	row("CorrectedP90(ms)", cs.S1.CorrectedP90, cs.S2.CorrectedP90)
+	row("CorrectedP95(ms)", cs.S1.CorrectedP95, cs.S2.CorrectedP95)
+	row("CorrectedP99(ms)", cs.S1.CorrectedP99, cs.S2.CorrectedP99)
+	row("CorrectedP99.9(ms)", cs.S1.CorrectedP999, cs.S2.CorrectedP999)
+	corrected := map[float64]float64{}
+	for p := range cs.S1.CorrectedPercentiles {
+		corrected[p] = 0
+	}
+	for p := range cs.S2.CorrectedPercentiles {
+		corrected[p] = 0
+	}
+	for _, p := range sortedPercentiles(corrected) {
+		row(correctedPercentileName(p), cs.S1.CorrectedPercentiles[p], cs.S2.CorrectedPercentiles[p])
+	}
 	writer.Flush()
 	return buf.String()
 }
@@ -633,7 +1839,23 @@ func RunCLI(w io.Writer, args []string) error {
 		if err != nil {
 			return err
 		}
-		err = tester.Run()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		finished := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				// a second signal terminates the process right away
+				stop()
+				tester.logf("stopping, press Ctrl-C again to force exit\n")
+			case <-finished:
+			}
+		}()
+		err = tester.RunContext(ctx)
+		close(finished)
+		if errors.Is(err, context.Canceled) {
+			return ErrInterrupted
+		}
 		if err != nil {
 			return err
 		}
@@ -2,13 +2,17 @@ package bench_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -477,6 +481,210 @@ func TestRecordTime_CalledMultipleTimesSetCorrectPercentilesAndReturnsNoError(t
 	}
 }
 
+func TestRecordCorrectedTime_CalledMultipleTimesSetCorrectPercentiles(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{5, 6, 7, 8, 10, 11, 13} {
+		tester.TimeRecorder.RecordTime(v)
+	}
+	for _, v := range []float64{5, 6, 7, 80, 100, 110, 130} {
+		tester.TimeRecorder.RecordCorrectedTime(v)
+	}
+	tester.CalculatePercentiles()
+	stats := tester.Stats()
+	// latencies are kept with three significant digits
+	if math.Abs(stats.CorrectedP50-80) > 0.08 {
+		t.Errorf("want corrected 50th percentile request time of 80ms, got %v", stats.CorrectedP50)
+	}
+	if math.Abs(stats.CorrectedP90-110) > 0.11 {
+		t.Errorf("want corrected 90th percentile request time of 110ms, got %v", stats.CorrectedP90)
+	}
+	if math.Abs(stats.CorrectedP99-130) > 0.13 {
+		t.Errorf("want corrected 99th percentile request time of 130ms, got %v", stats.CorrectedP99)
+	}
+	if stats.P99 != 13 {
+		t.Errorf("want 99th percentile request time of 13ms, got %v", stats.P99)
+	}
+}
+
+func TestCalculatePercentiles_SetsSummaryStatistics(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		tester.TimeRecorder.RecordTime(v)
+	}
+	tester.CalculatePercentiles()
+	stats := tester.Stats()
+	if stats.Min != 2 {
+		t.Errorf("want min request time of 2ms, got %v", stats.Min)
+	}
+	if stats.Max != 9 {
+		t.Errorf("want max request time of 9ms, got %v", stats.Max)
+	}
+	if stats.Mean != 5 {
+		t.Errorf("want mean request time of 5ms, got %v", stats.Mean)
+	}
+	if stats.StdDev != 2 {
+		t.Errorf("want request time standard deviation of 2ms, got %v", stats.StdDev)
+	}
+}
+
+func TestCalculatePercentiles_SetsDefaultAndExtraPercentiles(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithPercentiles(25, 95, 99.99),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 1; v <= 10000; v++ {
+		tester.TimeRecorder.RecordTime(float64(v) / 10)
+	}
+	tester.CalculatePercentiles()
+	stats := tester.Stats()
+	// values go from 0.1ms to 1000ms and are kept with three significant digits
+	wants := map[string][2]float64{
+		"P75":   {750, stats.P75},
+		"P95":   {950, stats.P95},
+		"P99.9": {999, stats.P999},
+	}
+	for name, v := range wants {
+		if math.Abs(v[0]-v[1]) > 1 {
+			t.Errorf("want %s request time of %vms, got %v", name, v[0], v[1])
+		}
+	}
+	want := map[float64]float64{25: 250, 99.99: 999.9}
+	if !cmp.Equal(want, stats.Percentiles, cmp.Comparer(func(x, y float64) bool {
+		return math.Abs(x-y) <= 1
+	})) {
+		t.Error(cmp.Diff(want, stats.Percentiles))
+	}
+}
+
+func TestCalculatePercentiles_SetsCorrectedDefaultAndExtraPercentiles(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithPercentiles(25, 99.99),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 1; v <= 10000; v++ {
+		tester.TimeRecorder.RecordTime(float64(v) / 10)
+		tester.TimeRecorder.RecordCorrectedTime(float64(v) / 5)
+	}
+	tester.CalculatePercentiles()
+	stats := tester.Stats()
+	// corrected values go from 0.2ms to 2000ms
+	wants := map[string][2]float64{
+		"CorrectedP50":   {1000, stats.CorrectedP50},
+		"CorrectedP75":   {1500, stats.CorrectedP75},
+		"CorrectedP90":   {1800, stats.CorrectedP90},
+		"CorrectedP95":   {1900, stats.CorrectedP95},
+		"CorrectedP99":   {1980, stats.CorrectedP99},
+		"CorrectedP99.9": {1998, stats.CorrectedP999},
+	}
+	for name, v := range wants {
+		if math.Abs(v[0]-v[1]) > 2 {
+			t.Errorf("want %s request time of %vms, got %v", name, v[0], v[1])
+		}
+	}
+	want := map[float64]float64{25: 500, 99.99: 1999.8}
+	if !cmp.Equal(want, stats.CorrectedPercentiles, cmp.Comparer(func(x, y float64) bool {
+		return math.Abs(x-y) <= 2
+	})) {
+		t.Error(cmp.Diff(want, stats.CorrectedPercentiles))
+	}
+}
+
+func TestWithPercentiles_ErrorsOnInvalidPercentile(t *testing.T) {
+	t.Parallel()
+	for _, p := range []float64{0, -1, 100.1} {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			bench.WithPercentiles(p),
+		)
+		if err == nil {
+			t.Errorf("want error for invalid percentile %v", p)
+		}
+	}
+}
+
+func TestFromArgs_PFlagSetsPercentiles(t *testing.T) {
+	t.Parallel()
+	args := []string{"-p", "50,95,99.9", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{50, 95, 99.9}
+	got := tester.Percentiles()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestFromArgs_PFlagErrorsOnInvalidPercentile(t *testing.T) {
+	t.Parallel()
+	args := []string{"-p", "50,p95", "-u", "http://fake.url"}
+	_, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err == nil {
+		t.Fatal("want error for invalid percentile p95")
+	}
+}
+
+func TestReadStats_RoundTripsSummaryStatisticsAndPercentiles(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:                  "http://fake.url",
+		Requests:             10,
+		Successes:            10,
+		Min:                  1.5,
+		Mean:                 10.25,
+		StdDev:               3.125,
+		Max:                  40,
+		P50:                  10,
+		P75:                  12,
+		P90:                  15,
+		P95:                  20,
+		P99:                  30,
+		P999:                 39,
+		Percentiles:          map[float64]float64{25: 8, 99.99: 39.5},
+		CorrectedP50:         11,
+		CorrectedP75:         13,
+		CorrectedP90:         16,
+		CorrectedP95:         21,
+		CorrectedP99:         31,
+		CorrectedP999:        40,
+		CorrectedPercentiles: map[float64]float64{25: 9, 99.99: 41},
+	}
+	got, err := bench.ReadStats(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
 func TestLogPrintsToStdoutAndStderr(t *testing.T) {
 	t.Parallel()
 
@@ -638,6 +846,11 @@ func TestWithGraphs_GeneratesGraphs(t *testing.T) {
 	if err != nil {
 		t.Errorf("want file %q to exist", filePath)
 	}
+	filePath = fmt.Sprintf("%s/%s", tester.OutputPath(), "phases.png")
+	_, err = os.Stat(filePath)
+	if err != nil {
+		t.Errorf("want file %q to exist", filePath)
+	}
 }
 
 func TestNewTester_ByDefaultDoesNotGenerateGraphs(t *testing.T) {
@@ -769,21 +982,42 @@ func TestReadStats_PopulatesCorrectStats(t *testing.T) {
 Requests: 10
 Successes: 9
 Failures: 1
+AssertionFailures: 0
+Late: 3
+Elapsed(ms): 2500.000
+RPS: 4.000
+SuccessRPS: 3.600
+BytesSent: 100
+BytesReceived: 2048
+MeanResponseSize(bytes): 204.800
 P50(ms): 221.607
 P90(ms): 261.139
-P99(ms): 319.947`)
+P99(ms): 319.947
+CorrectedP50(ms): 230.001
+CorrectedP90(ms): 290.500
+CorrectedP99(ms): 412.333`)
 	got, err := bench.ReadStats(statsReader)
 	if err != nil {
 		t.Fatal(err)
 	}
 	want := bench.Stats{
-		P50:       221.607,
-		P90:       261.139,
-		P99:       319.947,
-		Failures:  1,
-		Requests:  10,
-		Successes: 9,
-		URL:       "https://google.com",
+		P50:              221.607,
+		P90:              261.139,
+		P99:              319.947,
+		CorrectedP50:     230.001,
+		CorrectedP90:     290.500,
+		CorrectedP99:     412.333,
+		Elapsed:          2500,
+		RPS:              4,
+		SuccessRPS:       3.6,
+		BytesSent:        100,
+		BytesReceived:    2048,
+		MeanResponseSize: 204.8,
+		Failures:         1,
+		Late:             3,
+		Requests:         10,
+		Successes:        9,
+		URL:              "https://google.com",
 	}
 
 	if !cmp.Equal(want, got) {
@@ -842,9 +1076,30 @@ func TestStatsStringer_PopulatesCorrectStats(t *testing.T) {
 Requests: 20
 Successes: 18
 Failures: 2
+AssertionFailures: 0
+Late: 0
+Elapsed(ms): 0.000
+RPS: 0.000
+SuccessRPS: 0.000
+BytesSent: 0
+BytesReceived: 0
+MeanResponseSize(bytes): 0.000
+Min(ms): 0.000
+Mean(ms): 0.000
+StdDev(ms): 0.000
+Max(ms): 0.000
 P50(ms): 100.123
+P75(ms): 0.000
 P90(ms): 150.000
-P99(ms): 198.465`
+P95(ms): 0.000
+P99(ms): 198.465
+P99.9(ms): 0.000
+CorrectedP50(ms): 0.000
+CorrectedP75(ms): 0.000
+CorrectedP90(ms): 0.000
+CorrectedP95(ms): 0.000
+CorrectedP99(ms): 0.000
+CorrectedP99.9(ms): 0.000`
 	got := output.String()
 	if !cmp.Equal(want, got) {
 		t.Error(cmp.Diff(want, got))
@@ -879,6 +1134,98 @@ P99(ms)             120.000             101.000             -19.000
 	}
 }
 
+func TestCompareStats_StringerPrintsSummaryStatisticsAndPercentiles(t *testing.T) {
+	t.Parallel()
+	cs := bench.CompareStats{
+		S1: bench.Stats{
+			URL:         "http://fake.url",
+			Min:         10,
+			Mean:        50,
+			StdDev:      5,
+			Max:         200,
+			P50:         100,
+			P75:         105,
+			P90:         110,
+			P95:         115,
+			P99:         120,
+			P999:        150,
+			Percentiles: map[float64]float64{99.99: 190},
+		},
+		S2: bench.Stats{
+			URL:         "http://fake.url",
+			Min:         10,
+			Mean:        40,
+			StdDev:      4,
+			Max:         100,
+			P50:         99,
+			P75:         99.5,
+			P90:         100,
+			P95:         100.5,
+			P99:         101,
+			P999:        90,
+			Percentiles: map[float64]float64{99.99: 95},
+		},
+	}
+	want := `Site: http://fake.url
+Metric              Old                 New                 Delta               Percentage
+Min(ms)             10.000              10.000              0.000               0.00
+Mean(ms)            50.000              40.000              -10.000             -20.00
+StdDev(ms)          5.000               4.000               -1.000              -20.00
+Max(ms)             200.000             100.000             -100.000            -50.00
+P50(ms)             100.000             99.000              -1.000              -1.00
+P75(ms)             105.000             99.500              -5.500              -5.24
+P90(ms)             110.000             100.000             -10.000             -9.09
+P95(ms)             115.000             100.500             -14.500             -12.61
+P99(ms)             120.000             101.000             -19.000             -15.83
+P99.9(ms)           150.000             90.000              -60.000             -40.00
+P99.99(ms)          190.000             95.000              -95.000             -50.00
+`
+	got := cs.String()
+	if !cmp.Equal(want, got) {
+		t.Fatal(cmp.Diff(want, got))
+	}
+}
+
+func TestCompareStats_StringerPrintsCorrectedPercentiles(t *testing.T) {
+	t.Parallel()
+	cs := bench.CompareStats{
+		S1: bench.Stats{
+			URL:                  "http://fake.url",
+			CorrectedP50:         200,
+			CorrectedP75:         210,
+			CorrectedP90:         220,
+			CorrectedP95:         230,
+			CorrectedP99:         240,
+			CorrectedP999:        300,
+			CorrectedPercentiles: map[float64]float64{99.99: 380},
+		},
+		S2: bench.Stats{
+			URL:                  "http://fake.url",
+			CorrectedP50:         100,
+			CorrectedP75:         105,
+			CorrectedP90:         110,
+			CorrectedP95:         115,
+			CorrectedP99:         120,
+			CorrectedP999:        150,
+			CorrectedPercentiles: map[float64]float64{99.99: 190},
+		},
+	}
+	want := `Site: http://fake.url
+Metric              Old                 New                 Delta               Percentage
+CorrectedP50(ms)    200.000             100.000             -100.000            -50.00
+CorrectedP75(ms)    210.000             105.000             -105.000            -50.00
+CorrectedP90(ms)    220.000             110.000             -110.000            -50.00
+CorrectedP95(ms)    230.000             115.000             -115.000            -50.00
+CorrectedP99(ms)    240.000             120.000             -120.000            -50.00
+CorrectedP99.9(ms)  300.000             150.000             -150.000            -50.00
+CorrectedP99.99(ms) 380.000             190.000             -190.000            -50.00
+`
+	got := cs.String()
+	if !cmp.Equal(want, got) {
+		t.Fatal(cmp.Diff(want, got))
+	}
+}
+
 func TestRunCLI_ErrorsIfNoArgs(t *testing.T) {
 	t.Parallel()
 
@@ -945,9 +1292,30 @@ func TestStatsStringerPrintsExpectedMessage(t *testing.T) {
 Requests: 100
 Successes: 100
 Failures: 0
+AssertionFailures: 0
+Late: 0
+Elapsed(ms): 0.000
+RPS: 0.000
+SuccessRPS: 0.000
+BytesSent: 0
+BytesReceived: 0
+MeanResponseSize(bytes): 0.000
+Min(ms): 0.000
+Mean(ms): 0.000
+StdDev(ms): 0.000
+Max(ms): 0.000
 P50(ms): 800.231
+P75(ms): 0.000
 P90(ms): 880.000
-P99(ms): 901.987`
+P95(ms): 0.000
+P99(ms): 901.987
+P99.9(ms): 0.000
+CorrectedP50(ms): 0.000
+CorrectedP75(ms): 0.000
+CorrectedP90(ms): 0.000
+CorrectedP95(ms): 0.000
+CorrectedP99(ms): 0.000
+CorrectedP99.9(ms): 0.000`
 	got := stats.String()
 	if !cmp.Equal(want, got) {
 		t.Error(cmp.Diff(want, got))
@@ -1001,6 +1369,110 @@ func TestFromArgs_BFlagSetsRequestBody(t *testing.T) {
 	}
 }
 
+func TestFromArgs_BFlagReadsBodyFromFile(t *testing.T) {
+	t.Parallel()
+	path := t.TempDir() + "/body.bin"
+	want := []byte{0x00, 0xff, 0x10, '\n', 0x7f}
+	err := os.WriteFile(path, want, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-b", "@" + path, "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.BodyBytes()
+	if !bytes.Equal(want, got) {
+		t.Errorf("want tester body to be %v, got %v", want, got)
+	}
+}
+
+func TestFromArgs_BFlagReadsBodyFromStdin(t *testing.T) {
+	t.Parallel()
+	args := []string{"-b", "@-", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStdin(strings.NewReader(`{"language": "golang"}`)),
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"language": "golang"}`
+	got := tester.Body()
+	if want != got {
+		t.Errorf("want tester body to be %q, got %q", want, got)
+	}
+}
+
+func TestFromArgs_BFlagErrorsIfFileUnreadable(t *testing.T) {
+	t.Parallel()
+	args := []string{"-b", "@bogus", "-u", "http://fake.url"}
+	_, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("want error os.ErrNotExist got %v", err)
+	}
+}
+
+func TestWithBodyReader_ReadsBodyOnce(t *testing.T) {
+	t.Parallel()
+	want := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 1<<18)
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got, err := io.ReadAll(r.Body)
+		if err != nil || !bytes.Equal(want, got) {
+			http.Error(rw, "UnexpectedBody", http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithHTTPMethod(http.MethodPost),
+		bench.WithRequests(3),
+		bench.WithBodyReader(bytes.NewReader(want)),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("want the 1MiB body to be received in 3 requests, got %d", calls)
+	}
+	if tester.Stats().BytesSent != int64(3*len(want)) {
+		t.Errorf("want %d bytes sent, got %d", 3*len(want), tester.Stats().BytesSent)
+	}
+}
+
+func TestWithBodyBytes_SetsBody(t *testing.T) {
+	t.Parallel()
+	want := []byte{0x00, 0x01, 0x02}
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithBodyBytes(want),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.BodyBytes()
+	if !bytes.Equal(want, got) {
+		t.Errorf("want tester body to be %v, got %v", want, got)
+	}
+}
+
 func TestRun_WithBodySendsCorrectBody(t *testing.T) {
 	t.Parallel()
 	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
@@ -1079,3 +1551,621 @@ func TestFromArgs_TFlagSetsContentType(t *testing.T) {
 		t.Errorf("want tester content type to be %q, got %q", want, got)
 	}
 }
+
+func TestNewTester_ByDefaultSetsNoDuration(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.Duration()
+	if got != 0 {
+		t.Errorf("want tester default duration to be zero, got %s", got)
+	}
+}
+
+func TestWithDuration_SetsDuration(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithDuration(5*time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 5 * time.Minute
+	got := tester.Duration()
+	if want != got {
+		t.Errorf("want tester duration to be %s, got %s", want, got)
+	}
+}
+
+func TestWithDuration_ErrorsOnNegativeDuration(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithDuration(-time.Second),
+	)
+	if err == nil {
+		t.Fatal("want error for invalid duration (-1s)")
+	}
+}
+
+func TestFromArgs_DFlagSetsDuration(t *testing.T) {
+	t.Parallel()
+	args := []string{"-d", "30s", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 30 * time.Second
+	got := tester.Duration()
+	if want != got {
+		t.Errorf("want tester duration to be %s, got %s", want, got)
+	}
+}
+
+func TestRun_WithDurationKeepsRequestingUntilDeadline(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithDuration(200*time.Millisecond),
+		bench.WithConcurrency(2),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests < 2 {
+		t.Errorf("want more than one request in 200ms, got %d", stats.Requests)
+	}
+	if stats.Elapsed < 200 {
+		t.Errorf("want elapsed time of at least 200ms, got %.3f", stats.Elapsed)
+	}
+	wantRPS := float64(stats.Requests) / (stats.Elapsed / 1000)
+	if math.Abs(wantRPS-stats.RPS) > 0.001*wantRPS {
+		t.Errorf("want %.3f requests per second, got %.3f", wantRPS, stats.RPS)
+	}
+}
+
+func TestNewTester_ByDefaultSetsNoRate(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.Rate()
+	if got != 0 {
+		t.Errorf("want tester default rate to be zero, got %.3f", got)
+	}
+}
+
+func TestWithRate_SetsRate(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithRate(50),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.Rate()
+	if got != 50 {
+		t.Errorf("want tester rate to be 50, got %.3f", got)
+	}
+}
+
+func TestWithRate_ErrorsOnNegativeRate(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithRate(-1),
+	)
+	if err == nil {
+		t.Fatal("want error for invalid rate (-1)")
+	}
+}
+
+func TestFromArgs_RateFlagSetsRate(t *testing.T) {
+	t.Parallel()
+	args := []string{"-rate", "12.5", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.Rate()
+	if got != 12.5 {
+		t.Errorf("want tester rate to be 12.5, got %.3f", got)
+	}
+}
+
+func TestRun_WithRateSendsRequestsAtFixedInterval(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(5),
+		bench.WithRate(20),
+		bench.WithConcurrency(5),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests != 5 {
+		t.Errorf("want 5 requests made, got %d", stats.Requests)
+	}
+	// five requests at 20 per second are due over 200ms
+	if stats.Elapsed < 200 {
+		t.Errorf("want elapsed time of at least 200ms, got %.3f", stats.Elapsed)
+	}
+	if stats.Late != 0 {
+		t.Errorf("want no late requests, got %d", stats.Late)
+	}
+}
+
+func TestRun_WithRateRecordsLateRequestsWhenAllWorkersAreBusy(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(5),
+		bench.WithRate(100),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Late == 0 {
+		t.Error("want late requests when the server is slower than the rate")
+	}
+}
+
+func TestRun_WithRateAndDurationRecordsDroppedRequestsNeverSent(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithDuration(300*time.Millisecond),
+		bench.WithRate(100),
+		bench.WithConcurrency(1),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Dropped == 0 {
+		t.Error("want dropped requests when the only user is busy until the end")
+	}
+	// 100 requests per second are due every 10ms over 300ms
+	if stats.Requests+stats.Dropped != 30 {
+		t.Errorf("want 30 requests sent or dropped, got %d sent and %d dropped", stats.Requests, stats.Dropped)
+	}
+}
+
+func TestRun_WithRateAndNoBusyUsersDropsNoRequests(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithDuration(200*time.Millisecond),
+		bench.WithRate(20),
+		bench.WithConcurrency(2),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Dropped != 0 {
+		t.Errorf("want no dropped requests, got %d", tester.Stats().Dropped)
+	}
+}
+
+func TestReadStats_PopulatesDropped(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{URL: "http://fake.url", Requests: 3, Successes: 3, Late: 1, Dropped: 7}
+	text := want.String()
+	if !strings.Contains(text, "\nLate: 1\nDropped: 7\n") {
+		t.Errorf("want dropped line, got %q", text)
+	}
+	got, err := bench.ReadStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_WithRateCorrectedPercentilesIncludeTimeWaitingToBeSent(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(5),
+		bench.WithRate(100),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	// the fifth request is due at 40ms but can only be sent after the four
+	// previous ones took 100ms each
+	if stats.CorrectedP99 < 400 {
+		t.Errorf("want corrected 99th percentile of at least 400ms, got %.3f", stats.CorrectedP99)
+	}
+	if stats.P99 >= stats.CorrectedP99 {
+		t.Errorf("want raw 99th percentile (%.3f) below the corrected one (%.3f)", stats.P99, stats.CorrectedP99)
+	}
+}
+
+func TestRun_RecordsBytesSentAndReceived(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(4),
+		bench.WithBody(`{"language": "golang"}`),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.BytesSent != 88 {
+		t.Errorf("want 88 bytes sent, got %d", stats.BytesSent)
+	}
+	if stats.BytesReceived != 40 {
+		t.Errorf("want 40 bytes received, got %d", stats.BytesReceived)
+	}
+	if stats.MeanResponseSize != 10 {
+		t.Errorf("want mean response size of 10 bytes, got %.3f", stats.MeanResponseSize)
+	}
+	if stats.SuccessRPS <= 0 || stats.SuccessRPS > stats.RPS {
+		t.Errorf("want successful RPS between 0 and %.3f, got %.3f", stats.RPS, stats.SuccessRPS)
+	}
+}
+
+func TestRun_WorkerKeepsGoingAfterFailedRequests(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(5),
+		bench.WithConcurrency(1),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- tester.Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not finish after failed requests")
+	}
+	stats := tester.Stats()
+	if stats.Requests != 5 || stats.Failures != 5 {
+		t.Errorf("want 5 failed requests, got %d requests and %d failures", stats.Requests, stats.Failures)
+	}
+}
+
+func TestRun_AccountsForEveryRequestWhenTransportFails(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(10),
+		bench.WithConcurrency(2),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- tester.Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not finish after failed requests")
+	}
+	stats := tester.Stats()
+	if stats.Requests != 10 {
+		t.Errorf("want 10 requests, got %d", stats.Requests)
+	}
+	if stats.Successes+stats.Failures != stats.Requests {
+		t.Errorf("want successes (%d) and failures (%d) to add up to requests (%d)", stats.Successes, stats.Failures, stats.Requests)
+	}
+}
+
+func TestFromArgs_KFlagSetsKeepAlive(t *testing.T) {
+	t.Parallel()
+	args := []string{"-k", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tester.KeepAlive() {
+		t.Error("want keep-alive to be true")
+	}
+}
+
+func TestRun_WithKeepAliveReusesConnections(t *testing.T) {
+	t.Parallel()
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	for _, keepAlive := range []bool{false, true} {
+		atomic.StoreInt32(&conns, 0)
+		tester, err := bench.NewTester(
+			bench.WithURL(server.URL),
+			bench.WithRequests(5),
+			bench.WithKeepAlive(keepAlive),
+			bench.WithStdout(io.Discard),
+			bench.WithStderr(io.Discard),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tester.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := int32(5)
+		if keepAlive {
+			want = 1
+		}
+		got := atomic.LoadInt32(&conns)
+		if want != got {
+			t.Errorf("keep-alive %t: want %d connections, got %d", keepAlive, want, got)
+		}
+	}
+}
+
+func TestRun_WithResponseHashesCountsDistinctResponses(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "Hello %d", atomic.AddInt32(&calls, 1)%2)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(6),
+		bench.WithResponseHashes(true),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 2
+	got := tester.Stats().DistinctResponses
+	if want != got {
+		t.Errorf("want %d distinct responses, got %d", want, got)
+	}
+}
+
+func TestRunContext_StopsWhenContextIsCanceled(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			fmt.Fprintf(rw, "HelloWorld")
+		case <-r.Context().Done():
+		}
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithDuration(time.Minute),
+		bench.WithConcurrency(2),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = tester.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want error %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("want run to stop shortly after the context is done, took %s", elapsed)
+	}
+	stats := tester.Stats()
+	if !stats.Incomplete {
+		t.Error("want stats to be marked as incomplete")
+	}
+	if stats.Successes == 0 {
+		t.Error("want the requests completed before the cancellation to be reported")
+	}
+	if stats.Successes+stats.Failures != stats.Requests {
+		t.Errorf("want successes (%d) and failures (%d) to add up to requests (%d)", stats.Successes, stats.Failures, stats.Requests)
+	}
+}
+
+func TestRun_CompletedRunIsNotIncomplete(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Incomplete {
+		t.Error("want stats not to be marked as incomplete")
+	}
+}
+
+func TestReadStats_PopulatesIncomplete(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{URL: "http://fake.url", Incomplete: true, Requests: 3}
+	got, err := bench.ReadStats(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// This test is not parallel because the signal it sends would also stop any
+// other run listening to it
+func TestRunCLI_InterruptPrintsPartialStats(t *testing.T) {
+	var calls int32
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 10 {
+			close(started)
+		}
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	defer server.Close()
+	go func() {
+		<-started
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = p.Signal(os.Interrupt)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	buf := &bytes.Buffer{}
+	err := bench.RunCLI(buf, []string{"run", "-d", "1m", "-u", server.URL})
+	if !errors.Is(err, bench.ErrInterrupted) {
+		t.Fatalf("want error %v, got %v", bench.ErrInterrupted, err)
+	}
+	stats, err := bench.ReadStats(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Incomplete {
+		t.Error("want stats to be marked as incomplete")
+	}
+	if stats.Successes == 0 {
+		t.Error("want the requests completed before the interruption to be reported")
+	}
+}
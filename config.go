@@ -0,0 +1,565 @@
+package bench
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the declarative description of a benchmark read by
+// FromConfigFile. Its fields map to the functional options of the same name
+type config struct {
+	URL            string          `yaml:"url"`
+	Method         string          `yaml:"method"`
+	Requests       *int            `yaml:"requests"`
+	Duration       *time.Duration  `yaml:"duration"`
+	Concurrency    *int            `yaml:"concurrency"`
+	Rate           *float64        `yaml:"rate"`
+	Stages         []Stage         `yaml:"stages"`
+	ThinkTime      string          `yaml:"thinkTime"`
+	Pacing         *time.Duration  `yaml:"pacing"`
+	Headers        configHeaders   `yaml:"headers"`
+	Body           string          `yaml:"body"`
+	BodyFile       string          `yaml:"bodyFile"`
+	ContentType    string          `yaml:"contentType"`
+	UserAgent      string          `yaml:"userAgent"`
+	ExpectedStatus []string        `yaml:"expectedStatus"`
+	Percentiles    []float64       `yaml:"percentiles"`
+	Precision      *int            `yaml:"precision"`
+	KeepAlive      bool            `yaml:"keepAlive"`
+	Cookies        bool            `yaml:"cookies"`
+	HashResponses  bool            `yaml:"hashResponses"`
+	Graphs         bool            `yaml:"graphs"`
+	OutputPath     string          `yaml:"outputPath"`
+	Templates      bool            `yaml:"templates"`
+	Transport      configTransport `yaml:"transport"`
+	Assertions     configAsserts   `yaml:"assertions"`
+	Data           *configData     `yaml:"data"`
+	Endpoints      []configRequest `yaml:"endpoints"`
+	Flow           []configStep    `yaml:"flow"`
+}
+
+type configTransport struct {
+	DialTimeout        time.Duration `yaml:"dialTimeout"`
+	IdleConnTimeout    time.Duration `yaml:"idleConnTimeout"`
+	MaxIdleConns       int           `yaml:"maxIdleConns"`
+	InsecureSkipVerify bool          `yaml:"insecureSkipVerify"`
+	ServerName         string        `yaml:"serverName"`
+	CAFile             string        `yaml:"caFile"`
+}
+
+type configAsserts struct {
+	BodyContains []string `yaml:"bodyContains"`
+	BodyMatches  []string `yaml:"bodyMatches"`
+	Headers      []string `yaml:"headers"`
+	JSON         []string `yaml:"json"`
+}
+
+type configData struct {
+	File      string `yaml:"file"`
+	Order     string `yaml:"order"`
+	Exhausted string `yaml:"exhausted"`
+}
+
+type configRequest struct {
+	Name    string        `yaml:"name"`
+	Weight  int           `yaml:"weight"`
+	Method  string        `yaml:"method"`
+	URL     string        `yaml:"url"`
+	Headers configHeaders `yaml:"headers"`
+	Body    string        `yaml:"body"`
+}
+
+type configStep struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers configHeaders     `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Extract []configExtractor `yaml:"extract"`
+}
+
+// configExtractor extracts the variable Var from exactly one of the places
+// of a response
+type configExtractor struct {
+	Var    string `yaml:"var"`
+	JSON   string `yaml:"json"`
+	Regex  string `yaml:"regex"`
+	Header string `yaml:"header"`
+	Cookie string `yaml:"cookie"`
+}
+
+// extractor returns the Extractor described by x
+func (x configExtractor) extractor() (Extractor, error) {
+	var extractors []Extractor
+	if x.JSON != "" {
+		extractors = append(extractors, ExtractJSON(x.Var, x.JSON))
+	}
+	if x.Regex != "" {
+		re, err := regexp.Compile(x.Regex)
+		if err != nil {
+			return Extractor{}, err
+		}
+		extractors = append(extractors, ExtractRegex(x.Var, re))
+	}
+	if x.Header != "" {
+		extractors = append(extractors, ExtractHeader(x.Var, x.Header))
+	}
+	if x.Cookie != "" {
+		extractors = append(extractors, ExtractCookie(x.Var, x.Cookie))
+	}
+	if x.Var == "" || len(extractors) != 1 {
+		return Extractor{}, errors.New("extractor needs a var and one of json, regex, header or cookie")
+	}
+	return extractors[0], nil
+}
+
+// configOption is a functional option set by the key at path of a config
+type configOption struct {
+	opt  Option
+	path []string
+}
+
+// configHeaders are headers given as a map of names to a value or a list of
+// values
+type configHeaders http.Header
+
+func (h *configHeaders) UnmarshalYAML(node *yaml.Node) error {
+	raw := map[string]yaml.Node{}
+	err := node.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	*h = configHeaders{}
+	for name, value := range raw {
+		var values []string
+		if value.Kind == yaml.SequenceNode {
+			err = value.Decode(&values)
+		} else {
+			values = []string{""}
+			err = value.Decode(&values[0])
+		}
+		if err != nil {
+			return err
+		}
+		http.Header(*h)[http.CanonicalHeaderKey(name)] = values
+	}
+	return nil
+}
+
+// FromConfigFile is the functional option to set everything described in a
+// YAML or JSON config file while initializing a new Tester object. Environment
+// variables in the file, as $NAME or ${NAME}, are expanded before it is read,
+// and $$ stands for a literal $. Relative paths in the file are relative to
+// its directory. Errors point to the offending line of the file
+func FromConfigFile(path string) Option {
+	return func(t *Tester) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = readConfig(t, data, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("filename %q, err: %v", path, err)
+		}
+		return nil
+	}
+}
+
+// FromConfig is the functional option to set everything described in YAML or
+// JSON config read from r while initializing a new Tester object. Relative
+// paths are relative to the current directory. See FromConfigFile
+func FromConfig(r io.Reader) Option {
+	return func(t *Tester) error {
+		if r == nil {
+			return ErrValueCannotBeNil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return readConfig(t, data, ".")
+	}
+}
+
+// readConfig reads the config in data and applies it to t
+func readConfig(t *Tester, data []byte, dir string) error {
+	data, err := expandEnv(data)
+	if err != nil {
+		return err
+	}
+	root := &yaml.Node{}
+	err = yaml.Unmarshal(data, root)
+	if err != nil {
+		return configError(err)
+	}
+	if len(root.Content) == 0 {
+		return errors.New("empty config")
+	}
+	cfg := config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return configError(err)
+	}
+	return cfg.apply(t, root, dir)
+}
+
+// configError returns the errors of yaml, which already point to a line,
+// without their prefix
+func configError(err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return errors.New(strings.Join(typeErr.Errors, "; "))
+	}
+	return errors.New(strings.TrimPrefix(err.Error(), "yaml: "))
+}
+
+// envRE matches the environment variables to be expanded, as well as $$
+var envRE = regexp.MustCompile(`\$(\$|[A-Za-z_][A-Za-z0-9_]*|\{[A-Za-z_][A-Za-z0-9_]*\})`)
+
+// expandEnv replaces the environment variables in data by their values,
+// failing on the ones not set
+func expandEnv(data []byte) ([]byte, error) {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		var err error
+		lines[i] = envRE.ReplaceAllFunc(line, func(match []byte) []byte {
+			name := strings.Trim(string(match[1:]), "{}")
+			if name == "$" {
+				return []byte("$")
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("line %d: environment variable %s is not set", i+1, name)
+			}
+			return []byte(value)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// keyLine returns the line of the key at path in the document root, or of
+// the closest parent found. Sequence items are addressed by their index
+func keyLine(root *yaml.Node, path ...string) int {
+	node := root.Content[0]
+	line := node.Line
+	for _, key := range path {
+		switch node.Kind {
+		case yaml.MappingNode:
+			found := false
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					line = node.Content[i].Line
+					node = node.Content[i+1]
+					found = true
+					break
+				}
+			}
+			if !found {
+				return line
+			}
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(key)
+			if err != nil || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// apply sets the config to t through the functional options, checking the
+// values the way NewTester does so that errors point to their line
+func (c config) apply(t *Tester, root *yaml.Node, dir string) error {
+	at := func(err error, path ...string) error {
+		if err == nil {
+			return nil
+		}
+		return fmt.Errorf("line %d: %v", keyLine(root, path...), err)
+	}
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	var opts []configOption
+	add := func(opt Option, path ...string) {
+		opts = append(opts, configOption{opt, path})
+	}
+	if c.URL != "" {
+		if !c.Templates && c.Data == nil && c.Flow == nil {
+			err := validateURL(c.URL)
+			if err != nil {
+				return at(err, "url")
+			}
+		}
+		add(WithURL(c.URL), "url")
+	}
+	if c.Method != "" {
+		add(WithHTTPMethod(c.Method), "method")
+	}
+	if c.Requests != nil {
+		if *c.Requests < 1 {
+			return at(fmt.Errorf("%d is invalid number of requests", *c.Requests), "requests")
+		}
+		add(WithRequests(*c.Requests), "requests")
+	}
+	if c.Duration != nil {
+		if *c.Duration < 0 {
+			return at(fmt.Errorf("%s is invalid duration", *c.Duration), "duration")
+		}
+		add(WithDuration(*c.Duration), "duration")
+	}
+	if c.Concurrency != nil {
+		if *c.Concurrency < 1 {
+			return at(fmt.Errorf("%d is invalid concurrency", *c.Concurrency), "concurrency")
+		}
+		add(WithConcurrency(*c.Concurrency), "concurrency")
+	}
+	if c.Rate != nil {
+		if *c.Rate < 0 {
+			return at(fmt.Errorf("%.3f is invalid rate", *c.Rate), "rate")
+		}
+		add(WithRate(*c.Rate), "rate")
+	}
+	if c.Stages != nil {
+		for i, s := range c.Stages {
+			if s.Duration < 0 || s.Target < 0 {
+				return at(fmt.Errorf("stage %s is invalid", s), "stages", strconv.Itoa(i))
+			}
+		}
+		err := validateStages(c.Stages)
+		if err != nil {
+			return at(err, "stages")
+		}
+		add(WithStages(c.Stages...), "stages")
+	}
+	if c.ThinkTime != "" {
+		th, err := ParseThinkTime(c.ThinkTime)
+		if err == nil {
+			err = th.validate()
+		}
+		if err != nil {
+			return at(err, "thinkTime")
+		}
+		add(WithThinkTime(th), "thinkTime")
+	}
+	if c.Pacing != nil {
+		if *c.Pacing < 0 {
+			return at(fmt.Errorf("%s is invalid pacing", *c.Pacing), "pacing")
+		}
+		add(WithPacing(*c.Pacing), "pacing")
+	}
+	if c.Headers != nil {
+		add(WithHeaders(http.Header(c.Headers)), "headers")
+	}
+	if c.Body != "" && c.BodyFile != "" {
+		return at(errors.New("body and bodyFile cannot be both set"), "bodyFile")
+	}
+	if c.Body != "" {
+		add(WithBody(c.Body), "body")
+	}
+	if c.BodyFile != "" {
+		body, err := os.ReadFile(resolve(c.BodyFile))
+		if err != nil {
+			return at(err, "bodyFile")
+		}
+		add(WithBodyBytes(body), "bodyFile")
+	}
+	if c.ContentType != "" {
+		add(WithContentType(c.ContentType), "contentType")
+	}
+	if c.UserAgent != "" {
+		add(WithHTTPUserAgent(c.UserAgent), "userAgent")
+	}
+	if c.ExpectedStatus != nil {
+		err := validateStatuses(c.ExpectedStatus)
+		if err != nil {
+			return at(err, "expectedStatus")
+		}
+		add(WithExpectedStatus(c.ExpectedStatus...), "expectedStatus")
+	}
+	if c.Percentiles != nil {
+		for i, p := range c.Percentiles {
+			if p <= 0 || p > 100 {
+				return at(fmt.Errorf("%v is invalid percentile", p), "percentiles", strconv.Itoa(i))
+			}
+		}
+		add(WithPercentiles(c.Percentiles...), "percentiles")
+	}
+	if c.Precision != nil {
+		_, err := NewHistogram(*c.Precision)
+		if err != nil {
+			return at(err, "precision")
+		}
+		add(WithHistogramPrecision(*c.Precision), "precision")
+	}
+	if c.KeepAlive {
+		add(WithKeepAlive(true), "keepAlive")
+	}
+	if c.Cookies {
+		add(WithCookies(true), "cookies")
+	}
+	if c.HashResponses {
+		add(WithResponseHashes(true), "hashResponses")
+	}
+	if c.Graphs {
+		add(WithGraphs(true), "graphs")
+	}
+	if c.OutputPath != "" {
+		add(WithOutputPath(resolve(c.OutputPath)), "outputPath")
+	}
+	if c.Templates {
+		add(WithTemplates(true), "templates")
+	}
+	tr := c.Transport
+	if tr.DialTimeout != 0 {
+		add(WithDialTimeout(tr.DialTimeout), "transport", "dialTimeout")
+	}
+	if tr.IdleConnTimeout != 0 {
+		add(WithIdleConnTimeout(tr.IdleConnTimeout), "transport", "idleConnTimeout")
+	}
+	if tr.MaxIdleConns != 0 {
+		add(WithMaxIdleConns(tr.MaxIdleConns), "transport", "maxIdleConns")
+	}
+	if tr.InsecureSkipVerify || tr.ServerName != "" || tr.CAFile != "" {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: tr.InsecureSkipVerify,
+			ServerName:         tr.ServerName,
+		}
+		if tr.CAFile != "" {
+			pem, err := os.ReadFile(resolve(tr.CAFile))
+			if err != nil {
+				return at(err, "transport", "caFile")
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return at(fmt.Errorf("no certificates found in %q", tr.CAFile), "transport", "caFile")
+			}
+		}
+		add(WithTLSConfig(tlsConfig), "transport")
+	}
+	as := c.Assertions
+	for i, s := range as.BodyContains {
+		add(WithAssertions(BodyContains(s)), "assertions", "bodyContains", strconv.Itoa(i))
+	}
+	for i, s := range as.BodyMatches {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return at(err, "assertions", "bodyMatches", strconv.Itoa(i))
+		}
+		add(WithAssertions(BodyMatches(re)), "assertions", "bodyMatches", strconv.Itoa(i))
+	}
+	for i, s := range as.Headers {
+		a, err := parseHeaderAssertion(s)
+		if err != nil {
+			return at(err, "assertions", "headers", strconv.Itoa(i))
+		}
+		add(WithAssertions(a), "assertions", "headers", strconv.Itoa(i))
+	}
+	for i, s := range as.JSON {
+		a, err := parseJSONAssertion(s)
+		if err != nil {
+			return at(err, "assertions", "json", strconv.Itoa(i))
+		}
+		add(WithAssertions(a), "assertions", "json", strconv.Itoa(i))
+	}
+	if c.Data != nil {
+		d := *c.Data
+		if d.Order == "" {
+			d.Order = FeedSequential
+		}
+		if d.Exhausted == "" {
+			d.Exhausted = FeedLoop
+		}
+		if d.File == "" {
+			return at(errors.New("data file is required"), "data")
+		}
+		rows, err := ReadDataFile(resolve(d.File))
+		if err != nil {
+			return at(err, "data", "file")
+		}
+		feeder, err := NewDataFeeder(rows, d.Order, d.Exhausted)
+		if err != nil {
+			return at(err, "data")
+		}
+		add(WithDataFeeder(feeder), "data")
+	}
+	names := map[string]bool{}
+	for i, e := range c.Endpoints {
+		path := []string{"endpoints", strconv.Itoa(i)}
+		if e.Name == "" || strings.ContainsAny(e.Name, " \t\r\n") {
+			return at(fmt.Errorf("invalid endpoint name %q", e.Name), path...)
+		}
+		if names[e.Name] {
+			return at(fmt.Errorf("duplicate endpoint name %q", e.Name), path...)
+		}
+		names[e.Name] = true
+		if e.Weight < 0 {
+			return at(fmt.Errorf("%d is invalid weight", e.Weight), append(path, "weight")...)
+		}
+		add(WithEndpoints(Endpoint{
+			Name:    e.Name,
+			Weight:  e.Weight,
+			Method:  e.Method,
+			URL:     e.URL,
+			Headers: http.Header(e.Headers),
+			Body:    e.Body,
+		}), path...)
+	}
+	names = map[string]bool{}
+	for i, s := range c.Flow {
+		path := []string{"flow", strconv.Itoa(i)}
+		if s.Name == "" || strings.ContainsAny(s.Name, " \t\r\n") {
+			return at(fmt.Errorf("invalid step name %q", s.Name), path...)
+		}
+		if names[s.Name] {
+			return at(fmt.Errorf("duplicate step name %q", s.Name), path...)
+		}
+		names[s.Name] = true
+		step := Step{
+			Name:    s.Name,
+			Method:  s.Method,
+			URL:     s.URL,
+			Headers: http.Header(s.Headers),
+			Body:    s.Body,
+		}
+		for j, x := range s.Extract {
+			extractor, err := x.extractor()
+			if err != nil {
+				return at(err, append(path, "extract", strconv.Itoa(j))...)
+			}
+			step.Extractors = append(step.Extractors, extractor)
+		}
+		add(WithFlow(step), path...)
+	}
+	for _, o := range opts {
+		err := o.opt(t)
+		if err != nil {
+			return at(err, o.path...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package bench_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestFromConfigFile_SetsEverythingDescribedInYAML(t *testing.T) {
+	t.Setenv("BENCH_TEST_TOKEN", "secret")
+	tester, err := bench.NewTester(bench.FromConfigFile("testdata/scenario.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.URL != "https://api.example.com" {
+		t.Errorf("want URL https://api.example.com, got %q", tester.URL)
+	}
+	if tester.HTTPMethod() != http.MethodPost {
+		t.Errorf("want method POST, got %q", tester.HTTPMethod())
+	}
+	if tester.Concurrency() != 2 || tester.Requests() != 1000 || tester.Rate() != 50 {
+		t.Errorf("want concurrency 2, requests 1000 and rate 50, got %d, %d and %v", tester.Concurrency(), tester.Requests(), tester.Rate())
+	}
+	wantHeaders := http.Header{
+		"Authorization": {"Bearer secret"},
+		"X-Tags":        {"a", "b"},
+	}
+	if !cmp.Equal(wantHeaders, tester.Headers()) {
+		t.Error(cmp.Diff(wantHeaders, tester.Headers()))
+	}
+	if !strings.HasPrefix(tester.Body(), "user_id,term\n") {
+		t.Errorf("want body read from users.csv next to the config file, got %q", tester.Body())
+	}
+	if tester.ContentType() != "application/json" {
+		t.Errorf("want content type application/json, got %q", tester.ContentType())
+	}
+	wantStatus := []string{"200", "201", "3xx"}
+	if !cmp.Equal(wantStatus, tester.ExpectedStatus()) {
+		t.Error(cmp.Diff(wantStatus, tester.ExpectedStatus()))
+	}
+	if !cmp.Equal([]float64{99.99}, tester.Percentiles()) {
+		t.Errorf("want percentiles [99.99], got %v", tester.Percentiles())
+	}
+	if !tester.KeepAlive() || !tester.ResponseHashes() || !tester.Templates() {
+		t.Error("want keep alive, response hashes and templates to be true")
+	}
+	if tester.DataFeeder() == nil || len(tester.DataFeeder().Rows()) != 2 {
+		t.Error("want data feeder with the rows of users.jsonl")
+	}
+	wantEndpoints := []bench.Endpoint{
+		{Name: "list", Weight: 70, URL: "/items"},
+		{
+			Name:    "order",
+			Weight:  10,
+			Method:  "PUT",
+			URL:     "/orders/{{.Data.user_id}}",
+			Headers: http.Header{"X-Cost": {"$5"}},
+			Body:    `{"payload": {{.Data.payload}}}`,
+		},
+	}
+	if !cmp.Equal(wantEndpoints, tester.Endpoints()) {
+		t.Error(cmp.Diff(wantEndpoints, tester.Endpoints()))
+	}
+}
+
+func TestFromConfigFile_ReadsJSON(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(bench.FromConfigFile("testdata/scenario.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Stage{{Duration: 10 * time.Second, Target: 5}, {Duration: 20 * time.Second, Target: 0}}
+	if !cmp.Equal(want, tester.Stages()) {
+		t.Error(cmp.Diff(want, tester.Stages()))
+	}
+	if tester.Duration() != 30*time.Second {
+		t.Errorf("want duration 30s, got %s", tester.Duration())
+	}
+}
+
+func TestFromConfig_ErrorsPointToOffendingLine(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		config string
+		line   int
+	}{
+		"unknown field":      {"url: http://fake.url\nrequest: 10\n", 2},
+		"invalid type":       {"url: http://fake.url\nrequests: ten\n", 2},
+		"invalid duration":   {"url: http://fake.url\n\nduration: 30x\n", 3},
+		"invalid requests":   {"url: http://fake.url\nrequests: 0\n", 2},
+		"invalid URL":        {"method: GET\nurl: fake.url\n", 2},
+		"invalid status":     {"url: http://fake.url\nexpectedStatus:\n  - 200\n  - 6xx\n", 2},
+		"invalid percentile": {"url: http://fake.url\npercentiles:\n  - 99\n  - 101\n", 4},
+		"invalid stage":      {"url: http://fake.url\nstages:\n  - duration: 10s\n    target: -1\n", 3},
+		"invalid regex":      {"url: http://fake.url\nassertions:\n  bodyMatches: [\"(\"]\n", 3},
+		"unset variable":     {"url: http://fake.url\nheaders:\n  X-Token: ${BENCH_TEST_UNSET}\n", 3},
+		"invalid syntax":     {"url: http://fake.url\nheaders: [\n", 2},
+		"invalid endpoint":   {"url: http://fake.url\nendpoints:\n  - name: list\n  - name: list items\n", 4},
+		"invalid data order": {"url: http://fake.url/{{.Data.user_id}}\ndata:\n  file: testdata/users.csv\n  order: bogus\n", 2},
+		"invalid think time": {"url: http://fake.url\n\nthinkTime: 3s-1s\n", 3},
+		"invalid pacing":     {"url: http://fake.url\npacing: -2s\n", 2},
+	}
+	for name, tc := range testCases {
+		_, err := bench.NewTester(bench.FromConfig(strings.NewReader(tc.config)))
+		if err == nil {
+			t.Errorf("%s: want error", name)
+			continue
+		}
+		want := fmt.Sprintf("line %d:", tc.line)
+		if !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: want error starting with %q, got %q", name, want, err)
+		}
+	}
+}
+
+func TestFromConfig_ErrorsOnEmptyConfig(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(bench.FromConfig(strings.NewReader("# nothing\n")))
+	if err == nil {
+		t.Error("want error for empty config")
+	}
+}
+
+func TestRun_FromConfigSendsDescribedRequests(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.Header.Get("X-Token") != "secret" {
+			http.Error(rw, "UnexpectedRequest", http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	config := fmt.Sprintf(`
+url: %s
+method: DELETE
+requests: 10
+headers:
+  X-Token: secret
+expectedStatus: [204]
+`, server.URL)
+	tester, err := bench.NewTester(
+		bench.FromConfig(strings.NewReader(config)),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests != 10 || stats.Successes != 10 {
+		t.Errorf("want 10 successful requests, got %d requests and %d successes", stats.Requests, stats.Successes)
+	}
+}
+
+func TestFromArgs_ConfigFlagReadsConfigFile(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs([]string{"-f", "testdata/scenario.json"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.URL != "https://api.example.com/items" {
+		t.Errorf("want URL from config file, got %q", tester.URL)
+	}
+}
+
+func TestFromArgs_ConfigFlagErrorsWithOtherFlags(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs([]string{"-f", "testdata/scenario.json", "-c", "10"}),
+	)
+	if err != bench.ErrConfigWithFlags {
+		t.Errorf("want ErrConfigWithFlags, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// WithCookies is the functional option to give each user a cookie jar of its
+// own while initializing a new Tester object, so that the cookies set by the
+// responses, e.g. of a login, are sent along with the following requests of
+// the same user. The users receiving cookies are counted as sessions
+func WithCookies(cookies bool) Option {
+	return func(t *Tester) error {
+		t.cookies = cookies
+		return nil
+	}
+}
+
+// Cookies returns whether each user keeps the cookies set by the responses
+func (t Tester) Cookies() bool {
+	return t.cookies
+}
+
+// userClient returns the client a new user sends requests with: the client of
+// the Tester, or a copy of it with a cookie jar of its own when cookies are on.
+// Copies share the transport, so users still reuse connections
+func (t *Tester) userClient() *http.Client {
+	if !t.cookies {
+		return t.client
+	}
+	// without options, cookiejar.New never fails
+	jar, _ := cookiejar.New(nil)
+	client := *t.client
+	client.Jar = jar
+	return &client
+}
+
+// startsSession returns whether req, once sent, left the first cookies in the
+// jar of a user. The jar is checked rather than the response, as the cookies
+// may be set by a response the client followed a redirect from, e.g. of a login
+func (u *user) startsSession(req *http.Request) bool {
+	if u.session || u.client.Jar == nil || len(u.client.Jar.Cookies(req.URL)) == 0 {
+		return false
+	}
+	u.session = true
+	return true
+}
+
+// sessionsString returns the line of the sessions, only present when some
+// were established
+func sessionsString(s Stats) string {
+	if s.Sessions == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nSessions: %d", s.Sessions)
+}
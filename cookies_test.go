@@ -0,0 +1,146 @@
+package bench_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+// sessionServer returns a server setting a new session cookie on every
+// request without one, and the number of cookies set so far
+func sessionServer(t *testing.T) (*httptest.Server, func() int64) {
+	var issued int64
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err == nil {
+			return
+		}
+		n := atomic.AddInt64(&issued, 1)
+		http.SetCookie(rw, &http.Cookie{Name: "session", Value: fmt.Sprint(n), Path: "/"})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() int64 {
+		return atomic.LoadInt64(&issued)
+	}
+}
+
+func TestRun_WithCookiesKeepsSessionOfEachUser(t *testing.T) {
+	t.Parallel()
+	server, issued := sessionServer(t)
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(30),
+		bench.WithConcurrency(3),
+		bench.WithCookies(true),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := tester.Stats().Sessions
+	if sessions < 1 || sessions > 3 {
+		t.Errorf("want a session per user at most, got %d", sessions)
+	}
+	if int64(sessions) != issued() {
+		t.Errorf("want sessions to match the %d cookies set, got %d", issued(), sessions)
+	}
+}
+
+func TestRun_WithCookiesCountsSessionSetBeforeRedirect(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(rw http.ResponseWriter, r *http.Request) {
+		http.SetCookie(rw, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+		http.Redirect(rw, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(rw http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/login"),
+		bench.WithRequests(5),
+		bench.WithConcurrency(1),
+		bench.WithCookies(true),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Sessions != 1 {
+		t.Errorf("want 1 session, got %d", tester.Stats().Sessions)
+	}
+}
+
+func TestRun_ByDefaultDoesNotKeepCookies(t *testing.T) {
+	t.Parallel()
+	server, issued := sessionServer(t)
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(10),
+		bench.WithConcurrency(2),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued() != 10 {
+		t.Errorf("want a cookie set for every request, got %d", issued())
+	}
+	if tester.Stats().Sessions != 0 {
+		t.Errorf("want no sessions, got %d", tester.Stats().Sessions)
+	}
+}
+
+func TestFromArgs_CookiesFlagSetsCookies(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs([]string{"-cookies", "-u", "http://fake.url"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tester.Cookies() {
+		t.Error("want cookies to be true")
+	}
+}
+
+func TestReadStats_PopulatesSessions(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{URL: "http://fake.url", Requests: 10, Successes: 10, Sessions: 3}
+	text := want.String()
+	if !strings.Contains(text, "\nSessions: 3\n") {
+		t.Errorf("want sessions line, got %q", text)
+	}
+	got, err := bench.ReadStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
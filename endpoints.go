@@ -0,0 +1,280 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is a named request definition of a scenario. The requests of a run
+// are spread over its endpoints in proportion to their weights. Empty fields
+// take the values of the Tester: Method and Body its method and body, and URL
+// its URL, which a URL starting with / is a path relative to. Headers are
+// added to the ones of the Tester, replacing the ones with the same name
+type Endpoint struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers http.Header
+	Body    string
+	Weight  int
+}
+
+// WithEndpoints is the functional option to add endpoints to the scenario
+// while initializing a new Tester object. Names must be unique and without
+// spaces, and weights default to one
+func WithEndpoints(endpoints ...Endpoint) Option {
+	return func(t *Tester) error {
+		t.scenario = append(t.scenario, endpoints...)
+		return nil
+	}
+}
+
+// Endpoints returns the endpoints of the scenario, if any
+func (t Tester) Endpoints() []Endpoint {
+	return t.scenario
+}
+
+// httpMethods are the methods ParseEndpoint tells apart from the start of a URL
+var httpMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// templateActionRE matches the actions of a template, which may hold spaces
+var templateActionRE = regexp.MustCompile(`{{.*?}}`)
+
+// ParseEndpoint parses an endpoint in the format "name[=weight] [method] url",
+// e.g. "list=70 /items" or "order=10 POST /orders". The method is only taken
+// when it is a standard one, and the URL is the rest, so it may be a template
+// with spaces, e.g. "item /items/{{randInt 1 1000}}"
+func ParseEndpoint(s string) (Endpoint, error) {
+	invalid := fmt.Errorf("invalid endpoint %q, want \"name[=weight] [method] url\"", s)
+	head, rest := cutSpace(strings.TrimSpace(s))
+	if rest == "" {
+		return Endpoint{}, invalid
+	}
+	e := Endpoint{URL: rest}
+	name, weight, ok := strings.Cut(head, "=")
+	e.Name = name
+	if ok {
+		var err error
+		e.Weight, err = strconv.Atoi(weight)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("invalid endpoint %q: %v", s, err)
+		}
+	}
+	if method, rest := cutSpace(rest); rest != "" && httpMethods[strings.ToUpper(method)] {
+		e.Method = strings.ToUpper(method)
+		e.URL = rest
+	}
+	if strings.ContainsAny(templateActionRE.ReplaceAllString(e.URL, ""), " \t") {
+		return Endpoint{}, invalid
+	}
+	return e, nil
+}
+
+// cutSpace slices s around its first run of whitespace
+func cutSpace(s string) (before, after string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " \t")
+}
+
+// endpoint is a request definition resolved against the Tester, with its
+// templates parsed and the recorder of its stats, if it is a named one
+type endpoint struct {
+	name       string
+	method     string
+	url        string
+	headers    http.Header
+	body       []byte
+	weight     int
+	extractors []Extractor
+	templates  *requestTemplates
+	recorder   *statsRecorder
+}
+
+// buildEndpoints resolves the steps of the flow or the endpoints of the
+// scenario, or a single unnamed endpoint made of the URL, method, headers and
+// body of the Tester if there is neither, and checks they make valid requests
+func (t *Tester) buildEndpoints() error {
+	if len(t.steps) > 0 {
+		return t.buildFlow()
+	}
+	if len(t.scenario) == 0 {
+		e := &endpoint{
+			method:  t.httpMethod,
+			url:     t.URL,
+			headers: t.headers,
+			body:    t.body,
+			weight:  1,
+		}
+		t.endpoints = []*endpoint{e}
+		t.totalWeight = 1
+		return e.validate(t, nil)
+	}
+	names := map[string]bool{}
+	for _, s := range t.scenario {
+		e, err := t.newEndpoint(names, s.Name, s.Method, s.URL, s.Headers, s.Body)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %v", err)
+		}
+		if s.Weight < 0 {
+			return fmt.Errorf("endpoint %s: %d is invalid weight", s.Name, s.Weight)
+		}
+		e.weight = s.Weight
+		if e.weight == 0 {
+			e.weight = 1
+		}
+		err = e.validate(t, nil)
+		if err != nil {
+			return fmt.Errorf("endpoint %s: %v", s.Name, err)
+		}
+		t.endpoints = append(t.endpoints, e)
+		t.totalWeight += e.weight
+	}
+	return nil
+}
+
+// newEndpoint resolves a named request definition against the Tester,
+// checking its name is valid and not in names yet
+func (t *Tester) newEndpoint(names map[string]bool, name, method, rawURL string, headers http.Header, body string) (*endpoint, error) {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	if names[name] {
+		return nil, fmt.Errorf("duplicate name %q", name)
+	}
+	names[name] = true
+	e := &endpoint{
+		name:     name,
+		method:   strings.ToUpper(method),
+		url:      rawURL,
+		headers:  t.headers.Clone(),
+		body:     []byte(body),
+		recorder: newStatsRecorder(t.precision),
+	}
+	if e.method == "" {
+		e.method = t.httpMethod
+	}
+	switch {
+	case e.url == "":
+		e.url = t.URL
+	case strings.HasPrefix(e.url, "/"):
+		e.url = strings.TrimSuffix(t.URL, "/") + e.url
+	}
+	if e.headers == nil {
+		e.headers = http.Header{}
+	}
+	for name, values := range headers {
+		e.headers[http.CanonicalHeaderKey(name)] = values
+	}
+	if body == "" {
+		e.body = t.body
+	}
+	return e, nil
+}
+
+// validate parses the templates of the endpoint when templates are on, and
+// checks its URL is valid. The variables extracted by the previous steps of a
+// flow are given their names as values
+func (e *endpoint) validate(t *Tester, vars map[string]string) error {
+	if !t.templating {
+		return validateURL(e.url)
+	}
+	var err error
+	e.templates, err = newRequestTemplates(e.url, e.body, e.headers)
+	if err != nil {
+		return err
+	}
+	data := TemplateData{Vars: vars}
+	if t.feeder != nil {
+		data.Data = t.feeder.rows[0]
+	}
+	return e.templates.validate(data)
+}
+
+// request returns the URL, the body and the headers of a request to the
+// endpoint, evaluating its templates with data when templates are on
+func (e *endpoint) request(data TemplateData) (string, []byte, http.Header, error) {
+	if e.templates == nil {
+		return e.url, e.body, e.headers, nil
+	}
+	return e.templates.render(data)
+}
+
+// pickEndpoint returns an endpoint at random in proportion to the weights
+func (t *Tester) pickEndpoint() *endpoint {
+	if len(t.endpoints) == 1 {
+		return t.endpoints[0]
+	}
+	n := mathrand.Intn(t.totalWeight)
+	for _, e := range t.endpoints {
+		if n < e.weight {
+			return e
+		}
+		n -= e.weight
+	}
+	return t.endpoints[len(t.endpoints)-1]
+}
+
+// validateURL checks rawURL is an absolute URL
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	return nil
+}
+
+// calculateEndpoints breaks the stats down per named endpoint
+func (t *Tester) calculateEndpoints() {
+	t.overall.stats.Endpoints = nil
+	for _, e := range t.endpoints {
+		if e.recorder == nil {
+			continue
+		}
+		stats := e.recorder.stats
+		calculatePercentiles(e.recorder.TimeRecorder, &stats, t.percentiles)
+		stats.URL = e.url
+		calculateThroughput(&stats, t.endAt, e.recorder.responses)
+		if t.overall.stats.Endpoints == nil {
+			t.overall.stats.Endpoints = map[string]Stats{}
+		}
+		t.overall.stats.Endpoints[e.name] = stats
+	}
+}
+
+// endpointsString returns the stats of each endpoint sorted by name, only
+// present when there are endpoints
+func endpointsString(s Stats) string {
+	names := make([]string, 0, len(s.Endpoints))
+	for name := range s.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(buf, "\n\nEndpoint: %s\n%s", name, s.Endpoints[name])
+	}
+	return buf.String()
+}
@@ -0,0 +1,206 @@
+package bench_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestRun_WithEndpointsSpreadsRequestsByWeight(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	paths := map[string]int{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths[r.Method+" "+r.URL.Path]++
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(400),
+		bench.WithConcurrency(4),
+		bench.WithEndpoints(
+			bench.Endpoint{Name: "list", URL: "/items", Weight: 3},
+			bench.Endpoint{Name: "order", Method: http.MethodPost, URL: "/orders"},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	list, order := stats.Endpoints["list"], stats.Endpoints["order"]
+	if list.Requests != paths["GET /items"] || order.Requests != paths["POST /orders"] {
+		t.Fatalf("want endpoint requests to match the ones received %v, got list %d and order %d", paths, list.Requests, order.Requests)
+	}
+	if list.Requests+order.Requests != stats.Requests {
+		t.Errorf("want requests of all endpoints (%d) to add up to the total (%d)", list.Requests+order.Requests, stats.Requests)
+	}
+	if list.Requests <= 2*order.Requests {
+		t.Errorf("want about three list requests for each order one, got %d and %d", list.Requests, order.Requests)
+	}
+	if list.Successes != list.Requests || list.P50 <= 0 || list.URL != server.URL+"/items" {
+		t.Errorf("want list endpoint stats to be calculated, got %+v", list)
+	}
+}
+
+func TestRun_EndpointsTakeEmptyFieldsFromTester(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	got := map[string]string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(rw, "UnexpectedBody", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got[r.URL.Path] = r.Method + " " + r.Header.Get("X-Token") + " " + r.Header.Get("X-Name") + " " + string(body)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/default"),
+		bench.WithRequests(100),
+		bench.WithHTTPMethod(http.MethodPut),
+		bench.WithBody("default"),
+		bench.WithHeader("X-Token", "secret"),
+		bench.WithHeader("X-Name", "default"),
+		bench.WithEndpoints(
+			bench.Endpoint{Name: "default"},
+			bench.Endpoint{
+				Name:    "custom",
+				Method:  http.MethodPost,
+				URL:     server.URL + "/custom",
+				Headers: http.Header{"X-Name": []string{"custom"}},
+				Body:    "custom",
+			},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/default": "PUT secret default default",
+		"/custom":  "POST secret custom custom",
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestWithEndpoints_ErrorsOnInvalidEndpoints(t *testing.T) {
+	t.Parallel()
+	testCases := map[string][]bench.Endpoint{
+		"empty name":       {{URL: "/items"}},
+		"name with space":  {{Name: "list items", URL: "/items"}},
+		"duplicate name":   {{Name: "list", URL: "/items"}, {Name: "list", URL: "/orders"}},
+		"negative weight":  {{Name: "list", URL: "/items", Weight: -1}},
+		"URL without host": {{Name: "list", URL: "items"}},
+	}
+	for name, endpoints := range testCases {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			bench.WithEndpoints(endpoints...),
+		)
+		if err == nil {
+			t.Errorf("%s: want error for invalid endpoints", name)
+		}
+	}
+}
+
+func TestParseEndpoint_ParsesNameWeightMethodAndURL(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bench.Endpoint{
+		"list /items":                                {Name: "list", URL: "/items"},
+		"list=70 /items":                             {Name: "list", Weight: 70, URL: "/items"},
+		"order=10 POST http://a/b":                   {Name: "order", Weight: 10, Method: "POST", URL: "http://a/b"},
+		"  item   GET   /items/1    ":                {Name: "item", Method: "GET", URL: "/items/1"},
+		"order post /orders":                         {Name: "order", Method: "POST", URL: "/orders"},
+		"item=20 /items/{{randInt 1 1000}}":          {Name: "item", Weight: 20, URL: "/items/{{randInt 1 1000}}"},
+		"get /x/{{ .Seq }}":                          {Name: "get", URL: "/x/{{ .Seq }}"},
+		"item PUT /items/{{ .Seq }}?q={{ .Worker }}": {Name: "item", Method: "PUT", URL: "/items/{{ .Seq }}?q={{ .Worker }}"},
+	}
+	for input, want := range testCases {
+		got, err := bench.ParseEndpoint(input)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if !cmp.Equal(want, got) {
+			t.Errorf("%q: %s", input, cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestParseEndpoint_ErrorsOnInvalidInput(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"", "list", "list=a /items", "list GET /items extra", "item /items/{{ .Seq }} extra"} {
+		_, err := bench.ParseEndpoint(input)
+		if err == nil {
+			t.Errorf("%q: want error", input)
+		}
+	}
+}
+
+func TestFromArgs_EndpointFlagAddsEndpoints(t *testing.T) {
+	t.Parallel()
+	args := []string{"-u", "http://fake.url", "-e", "list=70 /items", "-e", "order=10 POST /orders"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Endpoint{
+		{Name: "list", Weight: 70, URL: "/items"},
+		{Name: "order", Weight: 10, Method: "POST", URL: "/orders"},
+	}
+	got := tester.Endpoints()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadStats_PopulatesEndpointsStats(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:       "http://fake.url",
+		Requests:  30,
+		Successes: 30,
+		P50:       10,
+		Endpoints: map[string]bench.Stats{
+			"list":  {URL: "http://fake.url/items", Requests: 20, Successes: 20, P50: 9},
+			"order": {URL: "http://fake.url/orders", Requests: 10, Successes: 10, P50: 11},
+		},
+	}
+	text := want.String()
+	if strings.Index(text, "Endpoint: list") > strings.Index(text, "Endpoint: order") {
+		t.Errorf("want endpoints sorted by name, got %q", text)
+	}
+	got, err := bench.ReadStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,212 @@
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Categories of the errors of requests that got no response
+const (
+	ErrorCanceled          = "Canceled"
+	ErrorTimeout           = "Timeout"
+	ErrorConnectionReset   = "ConnectionReset"
+	ErrorConnectionRefused = "ConnectionRefused"
+	ErrorTLS               = "TLS"
+	ErrorDNS               = "DNS"
+	ErrorOther             = "Other"
+)
+
+// errorCategories lists the categories of errors in the order they are
+// reported
+var errorCategories = []string{
+	ErrorCanceled,
+	ErrorTimeout,
+	ErrorConnectionReset,
+	ErrorConnectionRefused,
+	ErrorTLS,
+	ErrorDNS,
+	ErrorOther,
+}
+
+// ErrorCategory returns the category err falls into
+func ErrorCategory(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ErrorCanceled
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && !dnsErr.IsTimeout {
+		return ErrorDNS
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorConnectionReset
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return ErrorTLS
+	}
+	return ErrorOther
+}
+
+// ExpectedStatus returns the status codes and classes considered successful
+func (t Tester) ExpectedStatus() []string {
+	return t.expectedStatus
+}
+
+// validateStatuses checks every status is either a code or a class of codes
+func validateStatuses(statuses []string) error {
+	if len(statuses) == 0 {
+		return errors.New("no expected status")
+	}
+	for _, status := range statuses {
+		if len(status) == 3 && status[0] >= '1' && status[0] <= '5' && strings.ToLower(status[1:]) == "xx" {
+			continue
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("%q is invalid status, want a code (e.g. 201) or a class (e.g. 2xx)", status)
+		}
+	}
+	return nil
+}
+
+// isExpectedStatus returns whether code matches any of the expected statuses
+func (t *Tester) isExpectedStatus(code int) bool {
+	for _, status := range t.expectedStatus {
+		if strings.ToLower(status[1:]) == "xx" {
+			if int(status[0]-'0') == code/100 {
+				return true
+			}
+			continue
+		}
+		expected, _ := strconv.Atoi(status)
+		if expected == code {
+			return true
+		}
+	}
+	return false
+}
+
+// expectsRedirect returns whether any of the expected statuses is a
+// redirection code or class
+func (t *Tester) expectsRedirect() bool {
+	for _, status := range t.expectedStatus {
+		if strings.HasPrefix(status, "3") {
+			return true
+		}
+	}
+	return false
+}
+
+// statusError is the failure of a response whose status code is not expected
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", int(e))
+}
+
+func addStatus(stats *Stats, code int) {
+	if stats.StatusCodes == nil {
+		stats.StatusCodes = map[int]int{}
+	}
+	stats.StatusCodes[code]++
+}
+
+func addError(stats *Stats, category string) {
+	if stats.Errors == nil {
+		stats.Errors = map[string]int{}
+	}
+	stats.Errors[category]++
+}
+
+// failuresString returns the lines of the status codes, in ascending order,
+// and of the error categories
+func failuresString(s Stats) string {
+	buf := &strings.Builder{}
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(buf, "\nStatus%d: %d", code, s.StatusCodes[code])
+	}
+	for _, category := range errorCategories {
+		n, ok := s.Errors[category]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(buf, "\nError%s: %d", category, n)
+	}
+	return buf.String()
+}
+
+// readFailureLine sets the status code or error category count named by
+// field, e.g. Status503: or ErrorTimeout:, to the given stats. It returns
+// false if field is neither
+func readFailureLine(stats *Stats, field, value string) (bool, error) {
+	name := strings.TrimSuffix(field, ":")
+	if strings.HasPrefix(name, "Status") {
+		code, err := strconv.Atoi(strings.TrimPrefix(name, "Status"))
+		if err != nil {
+			return false, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return true, err
+		}
+		if stats.StatusCodes == nil {
+			stats.StatusCodes = map[int]int{}
+		}
+		stats.StatusCodes[code] = n
+		return true, nil
+	}
+	for _, category := range errorCategories {
+		if name != "Error"+category {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return true, err
+		}
+		if stats.Errors == nil {
+			stats.Errors = map[string]int{}
+		}
+		stats.Errors[category] = n
+		return true, nil
+	}
+	return false, nil
+}
+
+// canceled returns err wrapped with the error of ctx when ctx is done, since
+// err may carry the cause of the cancellation rather than the cancellation
+// itself
+func canceled(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ctx.Err(), err)
+}
@@ -0,0 +1,303 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestErrorCategory_ClassifiesErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		err  error
+		want string
+	}{
+		{err: context.Canceled, want: bench.ErrorCanceled},
+		{err: context.DeadlineExceeded, want: bench.ErrorTimeout},
+		{err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: bench.ErrorConnectionReset},
+		{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, want: bench.ErrorConnectionRefused},
+		{err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "bogus.invalid"}}, want: bench.ErrorDNS},
+		{err: &net.DNSError{Err: "i/o timeout", Name: "slow.invalid", IsTimeout: true}, want: bench.ErrorTimeout},
+		{err: errors.New("something else"), want: bench.ErrorOther},
+	}
+	for _, tc := range testCases {
+		got := bench.ErrorCategory(tc.err)
+		if tc.want != got {
+			t.Errorf("%v: want category %q, got %q", tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestRun_CountsResponsesByStatusCode(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 0 {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(4),
+		bench.WithConcurrency(4),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{http.StatusOK: 2, http.StatusServiceUnavailable: 2}
+	got := tester.Stats().StatusCodes
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_CategorisesConnectionRefused(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{bench.ErrorConnectionRefused: 1}
+	got := tester.Stats().Errors
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_CategorisesTimeouts(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	client := server.Client()
+	client.Timeout = 10 * time.Millisecond
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithHTTPClient(client),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{bench.ErrorTimeout: 1}
+	got := tester.Stats().Errors
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadStats_PopulatesStatusCodesAndErrors(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:               "http://fake.url",
+		Requests:          20,
+		Successes:         15,
+		Failures:          5,
+		AssertionFailures: 2,
+		StatusCodes:       map[int]int{200: 15, 404: 1, 503: 2},
+		Errors:            map[string]int{bench.ErrorTimeout: 1, bench.ErrorOther: 1},
+	}
+	text := want.String()
+	if !strings.Contains(text, "Failures: 5\nAssertionFailures: 2\nStatus200: 15\nStatus404: 1\nStatus503: 2\nErrorTimeout: 1\nErrorOther: 1\nLate: 0") {
+		t.Errorf("want status codes and errors after failures, got:\n%s", text)
+	}
+	got, err := bench.ReadStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestNewTester_ByDefaultExpectsStatusOK(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"200"}
+	got := tester.ExpectedStatus()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestFromArgs_SFlagSetsExpectedStatus(t *testing.T) {
+	t.Parallel()
+	args := []string{"-s", "200, 201,3xx", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"200", "201", "3xx"}
+	got := tester.ExpectedStatus()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestWithExpectedStatus_ErrorsOnInvalidStatus(t *testing.T) {
+	t.Parallel()
+	inputs := [][]string{
+		{},
+		{""},
+		{"ok"},
+		{"99"},
+		{"600"},
+		{"6xx"},
+		{"2x"},
+	}
+	for _, statuses := range inputs {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			bench.WithExpectedStatus(statuses...),
+		)
+		if err == nil {
+			t.Errorf("want error for invalid statuses %q", statuses)
+		}
+	}
+}
+
+func TestRun_WithExpectedStatusAcceptsCodesAndClasses(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			rw.WriteHeader(http.StatusCreated)
+		case 2:
+			rw.WriteHeader(http.StatusNoContent)
+		case 3:
+			rw.WriteHeader(http.StatusOK)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(4),
+		bench.WithConcurrency(4),
+		bench.WithExpectedStatus("201", "2xx"),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Successes != 3 {
+		t.Errorf("want 3 successes, got %d", stats.Successes)
+	}
+	if stats.Failures != 1 {
+		t.Errorf("want 1 failure, got %d", stats.Failures)
+	}
+}
+
+func TestRun_WithExpectedRedirectDoesNotFollowIt(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "/new", http.StatusFound)
+	})
+	var followed int32
+	mux.HandleFunc("/new", func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&followed, 1)
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/old"),
+		bench.WithRequests(3),
+		bench.WithExpectedStatus("3xx"),
+		bench.WithTLSConfig(server.Client().Transport.(*http.Transport).TLSClientConfig),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{http.StatusFound: 3}
+	got := tester.Stats().StatusCodes
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if tester.Stats().Successes != 3 {
+		t.Errorf("want 3 successes, got %d", tester.Stats().Successes)
+	}
+	if n := atomic.LoadInt32(&followed); n != 0 {
+		t.Errorf("want redirects not followed, got %d followed", n)
+	}
+}
+
+func TestNewTester_FollowsRedirectsUnlessOneIsExpected(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(bench.WithURL("http://fake.url"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.HTTPClient().CheckRedirect != nil {
+		t.Error("want redirects followed by default")
+	}
+	tester, err = bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithExpectedStatus("200", "301"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.HTTPClient().CheckRedirect == nil {
+		t.Error("want redirects not followed when 301 is expected")
+	}
+}
@@ -0,0 +1,235 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Orders in which a DataFeeder hands out its rows
+const (
+	// FeedSequential hands the rows out one after the other to all users
+	FeedSequential = "sequential"
+	// FeedRandom hands out a random row each time
+	FeedRandom = "random"
+	// FeedPerWorker splits the rows between the users, each going through its
+	// own share one after the other. There must be at least a row per user
+	// and, when stopping on exhaustion, the run stops as soon as any user has
+	// gone through its share
+	FeedPerWorker = "per-worker"
+)
+
+// Policies for when a DataFeeder runs out of rows
+const (
+	// FeedLoop starts over from the first row
+	FeedLoop = "loop"
+	// FeedStop stops sending requests, ending the run
+	FeedStop = "stop"
+)
+
+// DataRow is a record of a data file, keyed by column name
+type DataRow map[string]string
+
+// DataFeeder hands out the rows of a data file to the requests, to be used in
+// their templates as {{.Data.column}}. A DataFeeder keeps track of the rows
+// handed out, so it must not be shared between Testers
+type DataFeeder struct {
+	mu        sync.Mutex
+	rows      []DataRow
+	order     string
+	exhausted string
+	next      int
+	workers   int
+	perWorker map[int]int
+	done      chan struct{}
+}
+
+// NewDataFeeder creates a DataFeeder handing out rows in the given order
+// (FeedSequential, FeedRandom or FeedPerWorker), and either looping over them
+// or stopping the run when they are exhausted (FeedLoop or FeedStop)
+func NewDataFeeder(rows []DataRow, order, exhausted string) (*DataFeeder, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("no data rows to feed")
+	}
+	switch order {
+	case FeedSequential, FeedRandom, FeedPerWorker:
+	default:
+		return nil, fmt.Errorf("%q is invalid feed order, want %s, %s or %s", order, FeedSequential, FeedRandom, FeedPerWorker)
+	}
+	switch exhausted {
+	case FeedLoop, FeedStop:
+	default:
+		return nil, fmt.Errorf("%q is invalid policy for exhausted data, want %s or %s", exhausted, FeedLoop, FeedStop)
+	}
+	return &DataFeeder{
+		rows:      rows,
+		order:     order,
+		exhausted: exhausted,
+		workers:   1,
+		perWorker: map[int]int{},
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// WithDataFeeder is the functional option to feed the rows of a data file to
+// the requests while initializing a new Tester object. It turns templates on,
+// so that the rows can be used in the URL, the headers and the body
+func WithDataFeeder(feeder *DataFeeder) Option {
+	return func(t *Tester) error {
+		if feeder == nil {
+			return ErrValueCannotBeNil
+		}
+		t.feeder = feeder
+		t.templating = true
+		return nil
+	}
+}
+
+// DataFeeder returns the data feeder of the requests, if any
+func (t Tester) DataFeeder() *DataFeeder {
+	return t.feeder
+}
+
+// Rows returns the rows handed out by the feeder
+func (f *DataFeeder) Rows() []DataRow {
+	return f.rows
+}
+
+// row returns the row for the next request of the given worker, or false if
+// the rows are exhausted and the feeder does not loop over them, in which
+// case the done channel is closed to stop the run
+func (f *DataFeeder) row(worker int) (DataRow, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.order {
+	case FeedRandom:
+		return f.rows[mathrand.Intn(len(f.rows))], true
+	case FeedPerWorker:
+		// worker w owns the rows w, w+workers, w+2*workers...
+		share := (len(f.rows) - worker + f.workers - 1) / f.workers
+		n := f.perWorker[worker]
+		if n >= share && f.exhausted == FeedStop {
+			f.stop()
+			return nil, false
+		}
+		f.perWorker[worker] = n + 1
+		return f.rows[worker+n%share*f.workers], true
+	default:
+		if f.next >= len(f.rows) && f.exhausted == FeedStop {
+			f.stop()
+			return nil, false
+		}
+		row := f.rows[f.next%len(f.rows)]
+		f.next++
+		return row, true
+	}
+}
+
+// stop closes the done channel, if not closed yet. It must be called with the
+// mutex locked
+func (f *DataFeeder) stop() {
+	select {
+	case <-f.done:
+	default:
+		close(f.done)
+	}
+}
+
+// ReadDataFile reads the rows of a CSV file, or of a JSON lines file when its
+// extension is .jsonl, .ndjson or .json
+func ReadDataFile(path string) ([]DataRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rows []DataRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson", ".json":
+		rows, err = ReadJSONLines(f)
+	default:
+		rows, err = ReadCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filename %q, err: %v", path, err)
+	}
+	return rows, nil
+}
+
+// ReadCSV reads rows from CSV data whose first record holds the column names
+func ReadCSV(r io.Reader) ([]DataRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("no header with the column names")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows := []DataRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := DataRow{}
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ReadJSONLines reads rows from data holding a JSON object per line. Empty
+// lines are ignored, and values other than strings are kept JSON encoded
+func ReadJSONLines(r io.Reader) ([]DataRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	rows := []DataRow{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		object := map[string]json.RawMessage{}
+		err := json.Unmarshal([]byte(text), &object)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		row := DataRow{}
+		for name, raw := range object {
+			var s string
+			if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+				row[name] = s
+				continue
+			}
+			row[name] = string(raw)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// skippedString returns the line of the skipped units of work, only present
+// when some were
+func skippedString(s Stats) string {
+	if s.Skipped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nSkipped: %d", s.Skipped)
+}
@@ -0,0 +1,289 @@
+package bench_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestReadDataFile_ReadsCSVRowsByColumnName(t *testing.T) {
+	t.Parallel()
+	want := []bench.DataRow{
+		{"user_id": "1", "term": "shoes"},
+		{"user_id": "2", "term": "hats"},
+		{"user_id": "3", "term": "socks, wool"},
+	}
+	got, err := bench.ReadDataFile("testdata/users.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadDataFile_ReadsJSONLinesKeepingOtherValuesEncoded(t *testing.T) {
+	t.Parallel()
+	want := []bench.DataRow{
+		{"user_id": "1", "payload": `{"qty": 2}`},
+		{"user_id": "2", "payload": "null"},
+	}
+	got, err := bench.ReadDataFile("testdata/users.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadJSONLines_ErrorsWithLineOfInvalidObject(t *testing.T) {
+	t.Parallel()
+	_, err := bench.ReadJSONLines(strings.NewReader("{\"a\": \"1\"}\n[1, 2]\n"))
+	if err == nil {
+		t.Fatal("want error for line not holding an object")
+	}
+	if !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("want error for line 2, got %q", err)
+	}
+}
+
+func TestReadCSV_ErrorsOnRecordWithWrongNumberOfFields(t *testing.T) {
+	t.Parallel()
+	_, err := bench.ReadCSV(strings.NewReader("a,b\n1,2\n3\n"))
+	if err == nil {
+		t.Error("want error for record with wrong number of fields")
+	}
+}
+
+func TestNewDataFeeder_ErrorsOnInvalidInput(t *testing.T) {
+	t.Parallel()
+	rows := []bench.DataRow{{"a": "1"}}
+	testCases := map[string]struct {
+		rows             []bench.DataRow
+		order, exhausted string
+	}{
+		"no rows":        {nil, bench.FeedSequential, bench.FeedLoop},
+		"invalid order":  {rows, "bogus", bench.FeedLoop},
+		"invalid policy": {rows, bench.FeedRandom, "bogus"},
+	}
+	for name, tc := range testCases {
+		_, err := bench.NewDataFeeder(tc.rows, tc.order, tc.exhausted)
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestNewTester_ErrorsOnPerWorkerFeederWithFewerRowsThanUsers(t *testing.T) {
+	t.Parallel()
+	feeder, err := bench.NewDataFeeder([]bench.DataRow{{"a": "1"}}, bench.FeedPerWorker, bench.FeedLoop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bench.NewTester(
+		bench.WithURL("http://fake.url/{{.Data.a}}"),
+		bench.WithConcurrency(2),
+		bench.WithDataFeeder(feeder),
+	)
+	if err == nil {
+		t.Error("want error for fewer rows than users")
+	}
+}
+
+func TestNewTester_ErrorsOnTemplateUsingUnknownColumn(t *testing.T) {
+	t.Parallel()
+	feeder, err := bench.NewDataFeeder([]bench.DataRow{{"a": "1"}}, bench.FeedSequential, bench.FeedLoop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bench.NewTester(
+		bench.WithURL("http://fake.url/{{.Data.b}}"),
+		bench.WithDataFeeder(feeder),
+	)
+	if err == nil {
+		t.Error("want error for unknown column")
+	}
+}
+
+// recordingServer returns a server recording the path, the X-Worker header
+// and the body of each request
+func recordingServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	requests := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(rw, "UnexpectedBody", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Header.Get("X-Worker")+" "+r.URL.Path+" "+string(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestRun_WithDataFeederFeedsRowsToURLHeadersAndBody(t *testing.T) {
+	t.Parallel()
+	server, requests := recordingServer(t)
+	rows := []bench.DataRow{{"id": "a", "n": "1"}, {"id": "b", "n": "2"}}
+	feeder, err := bench.NewDataFeeder(rows, bench.FeedSequential, bench.FeedLoop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/users/{{.Data.id}}"),
+		bench.WithRequests(4),
+		bench.WithHTTPMethod(http.MethodPost),
+		bench.WithHeader("X-Worker", "{{.Data.n}}"),
+		bench.WithBody(`{"n": {{.Data.n}}}`),
+		bench.WithDataFeeder(feeder),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`1 /users/a {"n": 1}`,
+		`2 /users/b {"n": 2}`,
+		`1 /users/a {"n": 1}`,
+		`2 /users/b {"n": 2}`,
+	}
+	got := requests()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_WithDataFeederStoppingEndsRunWhenRowsAreExhausted(t *testing.T) {
+	t.Parallel()
+	server, requests := recordingServer(t)
+	rows := []bench.DataRow{{"id": "a"}, {"id": "b"}, {"id": "c"}}
+	feeder, err := bench.NewDataFeeder(rows, bench.FeedSequential, bench.FeedStop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/users/{{.Data.id}}"),
+		bench.WithRequests(100),
+		bench.WithConcurrency(2),
+		bench.WithDataFeeder(feeder),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests != 3 || stats.Successes != 3 {
+		t.Errorf("want 3 requests and successes, got %d and %d", stats.Requests, stats.Successes)
+	}
+	if stats.Skipped < 1 {
+		t.Errorf("want the units of work left without data to be skipped, got %d", stats.Skipped)
+	}
+	if stats.Incomplete {
+		t.Error("want stats not to be incomplete")
+	}
+	want := []string{" /users/a ", " /users/b ", " /users/c "}
+	got := requests()
+	sort.Strings(got)
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_WithPerWorkerDataFeederSplitsRowsBetweenUsers(t *testing.T) {
+	t.Parallel()
+	server, requests := recordingServer(t)
+	rows := []bench.DataRow{{"id": "a"}, {"id": "b"}, {"id": "c"}, {"id": "d"}}
+	feeder, err := bench.NewDataFeeder(rows, bench.FeedPerWorker, bench.FeedStop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/users/{{.Data.id}}"),
+		bench.WithRequests(4),
+		bench.WithConcurrency(2),
+		bench.WithHeader("X-Worker", "{{.Worker}}"),
+		bench.WithDataFeeder(feeder),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each user only ever gets its own rows, whatever its share of requests
+	for _, r := range requests() {
+		switch r {
+		case "0 /users/a ", "0 /users/c ", "1 /users/b ", "1 /users/d ":
+		default:
+			t.Errorf("unexpected request %q", r)
+		}
+	}
+}
+
+func TestFromArgs_DataFlagSetsDataFeederAndTemplates(t *testing.T) {
+	t.Parallel()
+	args := []string{"-data", "testdata/users.csv", "-data-order", "random", "-data-exhausted", "stop", "-u", "http://fake.url/{{.Data.user_id}}"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.DataFeeder() == nil {
+		t.Fatal("want data feeder to be set")
+	}
+	if len(tester.DataFeeder().Rows()) != 3 {
+		t.Errorf("want 3 rows, got %d", len(tester.DataFeeder().Rows()))
+	}
+	if !tester.Templates() {
+		t.Error("want templates to be true")
+	}
+}
+
+func TestReadStats_PopulatesSkipped(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{URL: "http://fake.url", Requests: 3, Successes: 3, Skipped: 2}
+	text := want.String()
+	if !strings.Contains(text, "\nSkipped: 2\n") {
+		t.Errorf("want skipped line, got %q", text)
+	}
+	got, err := bench.ReadStats(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,160 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Step is a request of a flow. Its fields are the same as the ones of an
+// Endpoint, and Extractors store values of its response into variables
+// available to the templates of the following steps as {{.Vars.name}}
+type Step struct {
+	Name       string
+	Method     string
+	URL        string
+	Headers    http.Header
+	Body       string
+	Extractors []Extractor
+}
+
+// Extractor extracts a value from a response whose status code is expected,
+// to be stored in the variable Var
+type Extractor struct {
+	Var     string
+	Extract func(resp *http.Response, body []byte) (string, error)
+}
+
+// WithFlow is the functional option to set a flow while initializing a new
+// Tester object. Each unit of work then goes through the steps of the flow
+// one after the other, e.g. logging in and using the token received, stopping
+// at the first failing step. The number of requests is the number of times
+// the flow is run. Variables are not shared between runs of a flow, and steps
+// are reported as endpoints. A flow turns templates on and cannot be combined
+// with endpoints
+func WithFlow(steps ...Step) Option {
+	return func(t *Tester) error {
+		for _, s := range steps {
+			for _, x := range s.Extractors {
+				if x.Extract == nil {
+					return ErrValueCannotBeNil
+				}
+			}
+		}
+		t.steps = append(t.steps, steps...)
+		t.templating = true
+		return nil
+	}
+}
+
+// Flow returns the steps of the flow, if any
+func (t Tester) Flow() []Step {
+	return t.steps
+}
+
+// ExtractJSON extracts the value at path of the JSON response body into the
+// variable name. See JSONPathEquals for how paths and values are written
+func ExtractJSON(name, path string) Extractor {
+	return Extractor{
+		Var: name,
+		Extract: func(resp *http.Response, body []byte) (string, error) {
+			v, err := jsonPath(body, path)
+			if err != nil {
+				return "", err
+			}
+			return jsonString(v)
+		},
+	}
+}
+
+// ExtractRegex extracts the first match of re in the response body into the
+// variable name, or its first group if it has any
+func ExtractRegex(name string, re *regexp.Regexp) Extractor {
+	return Extractor{
+		Var: name,
+		Extract: func(resp *http.Response, body []byte) (string, error) {
+			match := re.FindSubmatch(body)
+			if match == nil {
+				return "", fmt.Errorf("body does not match %q", re)
+			}
+			if len(match) > 1 {
+				return string(match[1]), nil
+			}
+			return string(match[0]), nil
+		},
+	}
+}
+
+// ExtractHeader extracts the value of the response header into the variable
+// name
+func ExtractHeader(name, header string) Extractor {
+	return Extractor{
+		Var: name,
+		Extract: func(resp *http.Response, body []byte) (string, error) {
+			values, ok := resp.Header[http.CanonicalHeaderKey(header)]
+			if !ok {
+				return "", fmt.Errorf("header %q not found", header)
+			}
+			return values[0], nil
+		},
+	}
+}
+
+// ExtractCookie extracts the value of the cookie set by the response into the
+// variable name
+func ExtractCookie(name, cookie string) Extractor {
+	return Extractor{
+		Var: name,
+		Extract: func(resp *http.Response, body []byte) (string, error) {
+			for _, c := range resp.Cookies() {
+				if c.Name == cookie {
+					return c.Value, nil
+				}
+			}
+			return "", fmt.Errorf("cookie %q not set", cookie)
+		},
+	}
+}
+
+// buildFlow resolves the steps of the flow into endpoints, checking each step
+// only uses the variables extracted by the previous ones
+func (t *Tester) buildFlow() error {
+	if len(t.scenario) > 0 {
+		return errors.New("flow cannot be combined with endpoints")
+	}
+	t.flow = true
+	names := map[string]bool{}
+	vars := map[string]string{}
+	for _, s := range t.steps {
+		e, err := t.newEndpoint(names, s.Name, s.Method, s.URL, s.Headers, s.Body)
+		if err != nil {
+			return fmt.Errorf("invalid step: %v", err)
+		}
+		e.extractors = s.Extractors
+		err = e.validate(t, vars)
+		if err != nil {
+			return fmt.Errorf("step %s: %v", s.Name, err)
+		}
+		for _, x := range s.Extractors {
+			if x.Var == "" {
+				return fmt.Errorf("step %s: extractor without variable name", s.Name)
+			}
+			vars[x.Var] = x.Var
+		}
+		t.endpoints = append(t.endpoints, e)
+	}
+	return nil
+}
+
+// extract stores the values extracted from a response into vars
+func (e *endpoint) extract(resp *http.Response, body []byte, vars map[string]string) error {
+	for _, x := range e.extractors {
+		value, err := x.Extract(resp, body)
+		if err != nil {
+			return fmt.Errorf("step %s: %s: %v", e.name, x.Var, err)
+		}
+		vars[x.Var] = value
+	}
+	return nil
+}
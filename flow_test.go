@@ -0,0 +1,234 @@
+package bench_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thiagonache/bench"
+)
+
+func TestRun_WithFlowPassesExtractedValuesToFollowingSteps(t *testing.T) {
+	t.Parallel()
+	var logins int64
+	var mu sync.Mutex
+	tokens := map[string]bool{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := atomic.AddInt64(&logins, 1)
+			token := fmt.Sprintf("token-%d", n)
+			mu.Lock()
+			tokens[token] = true
+			mu.Unlock()
+			http.SetCookie(rw, &http.Cookie{Name: "session", Value: "s" + token})
+			rw.Header().Set("X-User", "42")
+			fmt.Fprintf(rw, `{"data": {"token": %q}}`, token)
+		case "/users/42":
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			mu.Lock()
+			ok := tokens[token]
+			mu.Unlock()
+			if !ok || r.Header.Get("X-Session") != "s"+token {
+				http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(rw, `<a href="/orders?page=7">next</a>`)
+		case "/orders":
+			if r.URL.Query().Get("page") != "7" {
+				http.Error(rw, "UnexpectedPage", http.StatusBadRequest)
+			}
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(5),
+		bench.WithConcurrency(2),
+		bench.WithFlow(
+			bench.Step{
+				Name:   "login",
+				Method: http.MethodPost,
+				URL:    "/login",
+				Extractors: []bench.Extractor{
+					bench.ExtractJSON("token", "$.data.token"),
+					bench.ExtractCookie("session", "session"),
+					bench.ExtractHeader("user", "X-User"),
+				},
+			},
+			bench.Step{
+				Name: "profile",
+				URL:  "/users/{{.Vars.user}}",
+				Headers: http.Header{
+					"Authorization": {"Bearer {{.Vars.token}}"},
+					"X-Session":     {"{{.Vars.session}}"},
+				},
+				Extractors: []bench.Extractor{
+					bench.ExtractRegex("page", regexp.MustCompile(`page=(\d+)`)),
+				},
+			},
+			bench.Step{Name: "orders", URL: "/orders?page={{.Vars.page}}"},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests != 15 || stats.Successes != 15 {
+		t.Errorf("want 15 successful requests, got %d requests and %d successes", stats.Requests, stats.Successes)
+	}
+	for _, name := range []string{"login", "profile", "orders"} {
+		step := stats.Endpoints[name]
+		if step.Requests != 5 || step.Successes != 5 {
+			t.Errorf("want 5 successful requests for step %s, got %d requests and %d successes", name, step.Requests, step.Successes)
+		}
+	}
+}
+
+func TestRun_WithFlowStopsAtFailingStep(t *testing.T) {
+	t.Parallel()
+	var items int64
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/items" {
+			atomic.AddInt64(&items, 1)
+		}
+		fmt.Fprint(rw, `{}`)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(3),
+		bench.WithFlow(
+			bench.Step{Name: "login", URL: "/login", Extractors: []bench.Extractor{bench.ExtractJSON("token", "token")}},
+			bench.Step{Name: "items", URL: "/items?token={{.Vars.token}}"},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if stats.Requests != 3 || stats.Failures != 3 || stats.AssertionFailures != 3 {
+		t.Errorf("want 3 requests failing extraction, got %d requests, %d failures and %d assertion failures", stats.Requests, stats.Failures, stats.AssertionFailures)
+	}
+	if atomic.LoadInt64(&items) != 0 {
+		t.Errorf("want no requests after the failing step, got %d", items)
+	}
+}
+
+func TestWithFlow_ErrorsOnInvalidFlow(t *testing.T) {
+	t.Parallel()
+	testCases := map[string][]bench.Option{
+		"unknown variable": {bench.WithFlow(
+			bench.Step{Name: "login", URL: "/login", Extractors: []bench.Extractor{bench.ExtractJSON("token", "token")}},
+			bench.Step{Name: "items", URL: "/items/{{.Vars.id}}"},
+		)},
+		"variable of a later step": {bench.WithFlow(
+			bench.Step{Name: "items", URL: "/items/{{.Vars.token}}"},
+			bench.Step{Name: "login", URL: "/login", Extractors: []bench.Extractor{bench.ExtractJSON("token", "token")}},
+		)},
+		"duplicate name": {bench.WithFlow(bench.Step{Name: "a"}, bench.Step{Name: "a"})},
+		"nil extractor":  {bench.WithFlow(bench.Step{Name: "a", Extractors: []bench.Extractor{{Var: "a"}}})},
+		"with endpoints": {bench.WithFlow(bench.Step{Name: "a"}), bench.WithEndpoints(bench.Endpoint{Name: "b"})},
+	}
+	for name, opts := range testCases {
+		_, err := bench.NewTester(append(opts, bench.WithURL("http://fake.url"))...)
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestExtractors_ExtractValuesFromResponse(t *testing.T) {
+	t.Parallel()
+	resp := &http.Response{Header: http.Header{
+		"X-Id":       {"7"},
+		"Set-Cookie": {"session=abc; Path=/"},
+	}}
+	body := []byte(`{"items": [{"id": 42, "name": "a"}]} next=/page/3`)
+	testCases := map[string]struct {
+		extractor bench.Extractor
+		want      string
+	}{
+		"JSON number":  {bench.ExtractJSON("v", "$.items[0].id"), "42"},
+		"JSON string":  {bench.ExtractJSON("v", "items.0.name"), "a"},
+		"regex group":  {bench.ExtractRegex("v", regexp.MustCompile(`/page/(\d+)`)), "3"},
+		"regex match":  {bench.ExtractRegex("v", regexp.MustCompile(`/page/\d+`)), "/page/3"},
+		"header":       {bench.ExtractHeader("v", "x-id"), "7"},
+		"cookie":       {bench.ExtractCookie("v", "session"), "abc"},
+		"missing JSON": {bench.ExtractJSON("v", "$.bogus"), ""},
+		"no match":     {bench.ExtractRegex("v", regexp.MustCompile(`bogus`)), ""},
+		"no header":    {bench.ExtractHeader("v", "X-Bogus"), ""},
+		"no cookie":    {bench.ExtractCookie("v", "bogus"), ""},
+	}
+	for name, tc := range testCases {
+		got, err := tc.extractor.Extract(resp, body)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: want error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if tc.want != got {
+			t.Errorf("%s: want %q, got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestFromConfig_SetsFlow(t *testing.T) {
+	t.Parallel()
+	config := `
+url: http://fake.url
+flow:
+  - name: login
+    method: POST
+    url: /login
+    extract:
+      - {var: token, json: $.token}
+      - {var: session, cookie: session}
+  - name: items
+    url: /items
+    headers:
+      Authorization: Bearer {{.Vars.token}}
+`
+	tester, err := bench.NewTester(bench.FromConfig(strings.NewReader(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow := tester.Flow()
+	if len(flow) != 2 || flow[0].Name != "login" || len(flow[0].Extractors) != 2 || flow[1].Name != "items" {
+		t.Errorf("want login step with two extractors and items step, got %+v", flow)
+	}
+}
+
+func TestFromConfig_ErrorsOnExtractorWithoutOneSource(t *testing.T) {
+	t.Parallel()
+	config := "url: http://fake.url\nflow:\n  - name: login\n    extract:\n      - {var: token}\n"
+	_, err := bench.NewTester(bench.FromConfig(strings.NewReader(config)))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5:") {
+		t.Errorf("want error on line 5, got %v", err)
+	}
+}
@@ -1,10 +1,11 @@
 module github.com/thiagonache/bench
 
-go 1.17
+go 1.20
 
 require (
 	github.com/google/go-cmp v0.5.6
 	gonum.org/v1/plot v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// WithHeader is the functional option to add a header to the requests while
+// initializing a new Tester object. Headers set this way take precedence over
+// the default ones, e.g. user-agent, accept and content-type
+func WithHeader(name, value string) Option {
+	return func(t *Tester) error {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if t.headers == nil {
+			t.headers = http.Header{}
+		}
+		t.headers.Add(strings.TrimSpace(name), value)
+		return nil
+	}
+}
+
+// WithHeaders is the functional option to add a set of headers to the
+// requests while initializing a new Tester object. See WithHeader
+func WithHeaders(headers http.Header) Option {
+	return func(t *Tester) error {
+		for name, values := range headers {
+			for _, value := range values {
+				err := WithHeader(name, value)(t)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Headers returns the headers added to the requests
+func (t Tester) Headers() http.Header {
+	return t.headers
+}
+
+// ReadHeadersFile is a wrapper to avoid user paperwork of opening the file
+func ReadHeadersFile(path string) (http.Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	headers, err := ReadHeaders(f)
+	if err != nil {
+		return nil, fmt.Errorf("filename %q, err: %v", path, err)
+	}
+	return headers, nil
+}
+
+// ReadHeaders reads one header per line in the format "Name: value" from a
+// given io.Reader. Empty lines and lines starting with # are ignored
+func ReadHeaders(r io.Reader) (http.Header, error) {
+	scanner := bufio.NewScanner(r)
+	headers := http.Header{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, err := parseHeader(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		headers.Add(name, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+func parseHeader(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header %q, want \"Name: value\"", s)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// setHeaders sets the default headers of req and then the user ones, which
+// replace the defaults with the same name
+func (t *Tester) setHeaders(req *http.Request, headers http.Header) {
+	req.Header.Set("user-agent", t.userAgent)
+	req.Header.Set("accept", "*/*")
+	req.Header.Set("content-type", t.contentType)
+	for name, values := range headers {
+		if name == "Host" {
+			req.Host = values[len(values)-1]
+			continue
+		}
+		req.Header[name] = values
+	}
+}
@@ -0,0 +1,130 @@
+package bench_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestReadHeaders_IgnoresCommentsAndEmptyLines(t *testing.T) {
+	t.Parallel()
+	got, err := bench.ReadHeaders(strings.NewReader(`# auth
+Authorization: Bearer abc:123
+
+x-tenant: acme
+Cookie: a=1
+Cookie: b=2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := http.Header{
+		"Authorization": []string{"Bearer abc:123"},
+		"X-Tenant":      []string{"acme"},
+		"Cookie":        []string{"a=1", "b=2"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadHeaders_ErrorsWithLineNumber(t *testing.T) {
+	t.Parallel()
+	_, err := bench.ReadHeaders(strings.NewReader("X-Tenant: acme\nAuthorization\n"))
+	if err == nil {
+		t.Fatal("want error for invalid header")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("want error to point to line 2, got %q", err)
+	}
+}
+
+func TestFromArgs_HFlagAddsHeadersFromArgsAndFiles(t *testing.T) {
+	t.Parallel()
+	path := t.TempDir() + "/headers.txt"
+	err := os.WriteFile(path, []byte("X-Tenant: acme\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{
+		"-H", "Authorization: Bearer abc",
+		"-H", "@" + path,
+		"-H", "Cache-Control:no-cache",
+		"-u", "http://fake.url",
+	}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := http.Header{
+		"Authorization": []string{"Bearer abc"},
+		"X-Tenant":      []string{"acme"},
+		"Cache-Control": []string{"no-cache"},
+	}
+	got := tester.Headers()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestFromArgs_HFlagErrorsOnInvalidHeader(t *testing.T) {
+	t.Parallel()
+	inputs := []string{"Authorization", ": value", "Bad Name: value", "@bogus"}
+	for _, input := range inputs {
+		_, err := bench.NewTester(
+			bench.WithStderr(io.Discard),
+			bench.FromArgs([]string{"-H", input, "-u", "http://fake.url"}),
+		)
+		if err == nil {
+			t.Errorf("want error for invalid header %q", input)
+		}
+	}
+}
+
+func TestRun_SendsUserHeadersOverridingDefaults(t *testing.T) {
+	t.Parallel()
+	got := make(chan *http.Request, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got <- r
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithHeader("Authorization", "Bearer abc"),
+		bench.WithHeaders(http.Header{
+			"user-agent": []string{"CustomAgent"},
+			"Host":       []string{"api.example.com"},
+		}),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-got
+	if r.Header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("want authorization header %q, got %q", "Bearer abc", r.Header.Get("Authorization"))
+	}
+	if r.UserAgent() != "CustomAgent" {
+		t.Errorf("want user agent %q, got %q", "CustomAgent", r.UserAgent())
+	}
+	if r.Host != "api.example.com" {
+		t.Errorf("want host %q, got %q", "api.example.com", r.Host)
+	}
+	if r.Header.Get("Accept") != "*/*" {
+		t.Errorf("want default accept header, got %q", r.Header.Get("Accept"))
+	}
+}
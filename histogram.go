@@ -0,0 +1,215 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// DefaultHistogramPrecision sets the default number of significant decimal
+// digits kept by the latency histograms
+const DefaultHistogramPrecision = 3
+
+// Histogram is a high dynamic range histogram of execution times. Values are
+// recorded in milliseconds and stored with microsecond resolution in buckets
+// whose width grows with the magnitude of the values, so that every value is
+// kept within the configured number of significant digits no matter how large
+// it is. Memory is only allocated for the ranges of values actually recorded.
+// A Histogram is not safe for concurrent use.
+type Histogram struct {
+	precision                   int
+	subBucketCount              int
+	subBucketHalfCount          int
+	subBucketHalfCountMagnitude int
+	subBucketMask               int64
+	counts                      [][]int64
+	totalCount                  int64
+	min, max                    int64
+	sum, sumOfSquares           float64
+}
+
+// NewHistogram creates a Histogram keeping the given number of significant
+// decimal digits, which must be between 1 and 5
+func NewHistogram(precision int) (*Histogram, error) {
+	if precision < 1 || precision > 5 {
+		return nil, fmt.Errorf("%d is invalid histogram precision, want between 1 and 5", precision)
+	}
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(precision)
+	subBucketCountMagnitude := int(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	subBucketHalfCountMagnitude := subBucketCountMagnitude - 1
+	subBucketCount := 1 << subBucketCountMagnitude
+	return &Histogram{
+		precision:                   precision,
+		subBucketCount:              subBucketCount,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketHalfCountMagnitude: subBucketHalfCountMagnitude,
+		subBucketMask:               int64(subBucketCount - 1),
+		min:                         math.MaxInt64,
+	}, nil
+}
+
+// Precision returns the number of significant decimal digits kept
+func (h *Histogram) Precision() int {
+	return h.precision
+}
+
+// RecordValue adds an execution time in milliseconds to the histogram.
+// Negative values are recorded as zero
+func (h *Histogram) RecordValue(ms float64) {
+	h.recordCount(int64(math.Round(ms*1000)), 1)
+}
+
+func (h *Histogram) recordCount(v, count int64) {
+	if v < 0 {
+		v = 0
+	}
+	h.addCount(v, count)
+	h.totalCount += count
+	h.sum += float64(v) * float64(count)
+	h.sumOfSquares += float64(v) * float64(v) * float64(count)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// addCount adds count to the bucket holding v, allocating it if needed. The
+// lower half of the sub-buckets of every bucket but the first one would hold
+// values already held by the previous bucket, so only the upper half is
+// allocated
+func (h *Histogram) addCount(v, count int64) {
+	bucket, sub := h.indexes(v)
+	for len(h.counts) <= bucket {
+		h.counts = append(h.counts, nil)
+	}
+	offset := h.subBucketOffset(bucket)
+	if h.counts[bucket] == nil {
+		h.counts[bucket] = make([]int64, h.subBucketCount-offset)
+	}
+	h.counts[bucket][sub-offset] += count
+}
+
+// Merge adds all values recorded in other to the histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other.totalCount == 0 {
+		return
+	}
+	other.forEach(func(v, count int64) {
+		h.addCount(v, count)
+	})
+	h.totalCount += other.totalCount
+	h.sum += other.sum
+	h.sumOfSquares += other.sumOfSquares
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// TotalCount returns how many values were recorded
+func (h *Histogram) TotalCount() int64 {
+	return h.totalCount
+}
+
+// Min returns the smallest value recorded in milliseconds
+func (h *Histogram) Min() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return float64(h.min) / 1000
+}
+
+// Max returns the largest value recorded in milliseconds
+func (h *Histogram) Max() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return float64(h.max) / 1000
+}
+
+// Mean returns the arithmetic mean of the values recorded in milliseconds
+func (h *Histogram) Mean() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return h.sum / float64(h.totalCount) / 1000
+}
+
+// StdDev returns the population standard deviation of the values recorded in
+// milliseconds
+func (h *Histogram) StdDev() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.totalCount)
+	variance := h.sumOfSquares/float64(h.totalCount) - mean*mean
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(variance) / 1000
+}
+
+// ValueAtPercentile returns the value in milliseconds below which the given
+// percentage (between 0 and 100) of the recorded values fall. The value is
+// reported as the lowest value of the bucket it falls into, so it is exact
+// within the precision of the histogram
+func (h *Histogram) ValueAtPercentile(p float64) float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	countAtPercentile := int64(math.Round(p / 100 * float64(h.totalCount)))
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+	if countAtPercentile >= h.totalCount {
+		return h.Max()
+	}
+	var total, value int64
+	h.forEach(func(v, count int64) {
+		if total >= countAtPercentile {
+			return
+		}
+		total += count
+		value = v
+	})
+	if value < h.min {
+		value = h.min
+	}
+	return float64(value) / 1000
+}
+
+// forEach calls fn, in ascending order, with the lowest value of each non
+// empty bucket and how many values were recorded in it
+func (h *Histogram) forEach(fn func(v, count int64)) {
+	for bucket, counts := range h.counts {
+		for sub, count := range counts {
+			if count == 0 {
+				continue
+			}
+			fn(int64(sub+h.subBucketOffset(bucket))<<bucket, count)
+		}
+	}
+}
+
+// indexes returns the bucket and the sub-bucket where v is stored. Bucket 0
+// holds values with single unit resolution, and each following bucket holds
+// values twice as large as the previous one with half the resolution
+func (h *Histogram) indexes(v int64) (int, int) {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask))
+	bucket := pow2Ceiling - (h.subBucketHalfCountMagnitude + 1)
+	return bucket, int(v >> bucket)
+}
+
+// subBucketOffset returns the index of the first sub-bucket allocated for
+// bucket: none of the first bucket is left out, and every following bucket
+// starts at its upper half
+func (h *Histogram) subBucketOffset(bucket int) int {
+	if bucket == 0 {
+		return 0
+	}
+	return h.subBucketHalfCount
+}
@@ -0,0 +1,151 @@
+package bench_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestNewHistogram_ErrorsOnInvalidPrecision(t *testing.T) {
+	t.Parallel()
+	for _, precision := range []int{-1, 0, 6} {
+		_, err := bench.NewHistogram(precision)
+		if err == nil {
+			t.Errorf("want error for invalid precision %d", precision)
+		}
+	}
+}
+
+func TestHistogram_ByDefaultReturnsZeroValues(t *testing.T) {
+	t.Parallel()
+	h, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.TotalCount() != 0 {
+		t.Errorf("want no values recorded, got %d", h.TotalCount())
+	}
+	if h.ValueAtPercentile(99) != 0 {
+		t.Errorf("want zero 99th percentile, got %v", h.ValueAtPercentile(99))
+	}
+	if h.Min() != 0 || h.Max() != 0 {
+		t.Errorf("want zero min and max, got %v and %v", h.Min(), h.Max())
+	}
+}
+
+func TestHistogram_ValueAtPercentileIsWithinPrecision(t *testing.T) {
+	t.Parallel()
+	h, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one value per millisecond, up to 100 seconds
+	for v := 1; v <= 100000; v++ {
+		h.RecordValue(float64(v))
+	}
+	if h.TotalCount() != 100000 {
+		t.Errorf("want 100000 values recorded, got %d", h.TotalCount())
+	}
+	for _, p := range []float64{1, 50, 75, 90, 99, 99.9, 99.99} {
+		want := p * 1000
+		got := h.ValueAtPercentile(p)
+		if math.Abs(want-got) > want/1000 {
+			t.Errorf("want %v percentile within 0.1%% of %v, got %v", p, want, got)
+		}
+	}
+	if h.Min() != 1 {
+		t.Errorf("want min of 1ms, got %v", h.Min())
+	}
+	if h.Max() != 100000 {
+		t.Errorf("want max of 100000ms, got %v", h.Max())
+	}
+}
+
+func TestHistogram_KeepsMicrosecondResolutionForSmallValues(t *testing.T) {
+	t.Parallel()
+	h, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.RecordValue(0.25)
+	h.RecordValue(0.5)
+	h.RecordValue(1.125)
+	got := h.ValueAtPercentile(50)
+	if got != 0.5 {
+		t.Errorf("want 50th percentile of 0.5ms, got %v", got)
+	}
+}
+
+func TestHistogram_KeepsValuesAtBucketEdges(t *testing.T) {
+	t.Parallel()
+	h, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with three significant digits, the first bucket holds values up to
+	// 2.047ms and the second one up to 4.094ms, in steps of 2 microseconds
+	for _, v := range []float64{2.047, 2.048, 4.094, 4.096} {
+		h.RecordValue(v)
+	}
+	want := []float64{2.047, 2.048, 4.094}
+	got := []float64{h.ValueAtPercentile(25), h.ValueAtPercentile(50), h.ValueAtPercentile(75)}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestHistogram_MergeAddsValuesOfOtherHistogram(t *testing.T) {
+	t.Parallel()
+	h1, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := bench.NewHistogram(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{1, 2, 3} {
+		h1.RecordValue(v)
+	}
+	for _, v := range []float64{4, 5, 6, 7} {
+		h2.RecordValue(v)
+	}
+	h1.Merge(h2)
+	if h1.TotalCount() != 7 {
+		t.Errorf("want 7 values after merge, got %d", h1.TotalCount())
+	}
+	if h1.ValueAtPercentile(50) != 4 {
+		t.Errorf("want 50th percentile of 4ms, got %v", h1.ValueAtPercentile(50))
+	}
+	if h1.Min() != 1 || h1.Max() != 7 {
+		t.Errorf("want min 1ms and max 7ms, got %v and %v", h1.Min(), h1.Max())
+	}
+}
+
+func TestWithHistogramPrecision_ErrorsOnInvalidPrecision(t *testing.T) {
+	t.Parallel()
+	_, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithHistogramPrecision(6),
+	)
+	if err == nil {
+		t.Fatal("want error for invalid histogram precision (6)")
+	}
+}
+
+func TestWithHistogramPrecision_SetsPrecision(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithHistogramPrecision(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tester.TimeRecorder.ExecutionsTime.Precision()
+	if got != 2 {
+		t.Errorf("want histogram precision 2, got %d", got)
+	}
+}
@@ -0,0 +1,176 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"time"
+)
+
+// Distributions of the think time of the users
+const (
+	// ThinkFixed pauses for Min every time
+	ThinkFixed = "fixed"
+	// ThinkUniform pauses for a random time between Min and Max
+	ThinkUniform = "uniform"
+	// ThinkExponential pauses for a random time exponentially distributed
+	// around Mean, so that each user starts its iterations as a Poisson process
+	ThinkExponential = "exponential"
+)
+
+// ThinkTime is the pause of a user between the end of an iteration and the
+// start of the next one, like a real user reading a page before clicking on
+// the next link. An empty Distribution is ThinkFixed
+type ThinkTime struct {
+	Distribution string
+	Min, Max     time.Duration
+	Mean         time.Duration
+}
+
+// FixedThinkTime returns a think time pausing for d every time
+func FixedThinkTime(d time.Duration) ThinkTime {
+	return ThinkTime{Distribution: ThinkFixed, Min: d, Max: d}
+}
+
+// UniformThinkTime returns a think time pausing for a random time between min
+// and max
+func UniformThinkTime(min, max time.Duration) ThinkTime {
+	return ThinkTime{Distribution: ThinkUniform, Min: min, Max: max}
+}
+
+// ExponentialThinkTime returns a think time pausing for a random time
+// exponentially distributed around mean
+func ExponentialThinkTime(mean time.Duration) ThinkTime {
+	return ThinkTime{Distribution: ThinkExponential, Mean: mean}
+}
+
+// String returns the think time in the same format accepted by ParseThinkTime
+func (th ThinkTime) String() string {
+	switch th.Distribution {
+	case ThinkUniform:
+		return fmt.Sprintf("%s-%s", th.Min, th.Max)
+	case ThinkExponential:
+		return fmt.Sprintf("exp:%s", th.Mean)
+	}
+	return th.Min.String()
+}
+
+// ParseThinkTime parses a think time written as a duration for a fixed one,
+// e.g. "2s", as min-max for a uniform one, e.g. "1s-3s", or as exp:mean for an
+// exponential one, e.g. "exp:2s"
+func ParseThinkTime(s string) (ThinkTime, error) {
+	if mean, ok := strings.CutPrefix(s, "exp:"); ok {
+		d, err := time.ParseDuration(mean)
+		if err != nil {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: %v", s, err)
+		}
+		return ExponentialThinkTime(d), nil
+	}
+	if min, max, ok := strings.Cut(s, "-"); ok {
+		lo, err := time.ParseDuration(min)
+		if err != nil {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: %v", s, err)
+		}
+		hi, err := time.ParseDuration(max)
+		if err != nil {
+			return ThinkTime{}, fmt.Errorf("invalid think time %q: %v", s, err)
+		}
+		return UniformThinkTime(lo, hi), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return ThinkTime{}, fmt.Errorf("invalid think time %q: %v", s, err)
+	}
+	return FixedThinkTime(d), nil
+}
+
+// validate checks the think time can be drawn from
+func (th ThinkTime) validate() error {
+	switch th.Distribution {
+	case "", ThinkFixed:
+		if th.Min < 0 {
+			return fmt.Errorf("think time %s has invalid duration", th)
+		}
+	case ThinkUniform:
+		if th.Min < 0 || th.Max < th.Min {
+			return fmt.Errorf("think time %s has invalid range", th)
+		}
+	case ThinkExponential:
+		if th.Mean < 0 {
+			return fmt.Errorf("think time %s has invalid mean", th)
+		}
+	default:
+		return fmt.Errorf("invalid think time distribution %q", th.Distribution)
+	}
+	return nil
+}
+
+// draw returns how long to pause for this time
+func (th ThinkTime) draw() time.Duration {
+	switch th.Distribution {
+	case ThinkUniform:
+		return th.Min + time.Duration(mathrand.Int63n(int64(th.Max-th.Min)+1))
+	case ThinkExponential:
+		return time.Duration(mathrand.ExpFloat64() * float64(th.Mean))
+	}
+	return th.Min
+}
+
+// WithThinkTime is the functional option to set the pause of each user between
+// iterations while initializing a new Tester object, so that the concurrency
+// is the number of simultaneous users rather than of requests in flight
+func WithThinkTime(th ThinkTime) Option {
+	return func(t *Tester) error {
+		t.thinkTime = th
+		return nil
+	}
+}
+
+// ThinkTime returns the pause of each user between iterations
+func (t Tester) ThinkTime() ThinkTime {
+	return t.thinkTime
+}
+
+// WithPacing is the functional option to set the time between the starts of
+// two iterations of each user while initializing a new Tester object, e.g. a
+// request every 2s per user however long the responses take. When an
+// iteration takes longer than the pacing, the next one starts right away.
+// Along with a think time, the next iteration starts once both have passed
+func WithPacing(d time.Duration) Option {
+	return func(t *Tester) error {
+		t.pacing = d
+		return nil
+	}
+}
+
+// Pacing returns the time between the starts of two iterations of each user
+func (t Tester) Pacing() time.Duration {
+	return t.pacing
+}
+
+// pauses returns whether users pause between iterations
+func (t *Tester) pauses() bool {
+	return t.pacing > 0 || t.thinkTime != ThinkTime{}
+}
+
+// pause waits for the think time and the pacing of a user whose iteration
+// started at start. It returns false if the user should stop instead, because
+// quit is closed, ctx is done or no more work is coming
+func (t *Tester) pause(ctx context.Context, start time.Time, quit <-chan struct{}) bool {
+	until := start.Add(t.pacing)
+	think := time.Now().Add(t.thinkTime.draw())
+	if think.After(until) {
+		until = think
+	}
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-quit:
+	case <-ctx.Done():
+	case <-t.done:
+	}
+	return false
+}
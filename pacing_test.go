@@ -0,0 +1,182 @@
+package bench_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestRun_WithPacingSpacesIterationsOfEachUser(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(6),
+		bench.WithConcurrency(2),
+		bench.WithPacing(100*time.Millisecond),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond {
+		t.Errorf("want 3 iterations per user 100ms apart, run took %s", elapsed)
+	}
+	if tester.Stats().Successes != 6 {
+		t.Errorf("want 6 successes, got %d", tester.Stats().Successes)
+	}
+}
+
+func TestRun_WithThinkTimePausesUsersWithoutInflatingLatency(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(6),
+		bench.WithConcurrency(2),
+		bench.WithThinkTime(bench.FixedThinkTime(100*time.Millisecond)),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond {
+		t.Errorf("want users to think 100ms between iterations, run took %s", elapsed)
+	}
+	if tester.Stats().CorrectedP99 >= 100 {
+		t.Errorf("want think time left out of corrected latency, got p99 %.3fms", tester.Stats().CorrectedP99)
+	}
+}
+
+func TestRun_DoesNotThinkAfterLastRequest(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(1),
+		bench.WithThinkTime(bench.ExponentialThinkTime(time.Hour)),
+		bench.WithPacing(time.Hour),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- tester.Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not end after the last request")
+	}
+}
+
+func TestParseThinkTime(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bench.ThinkTime{
+		"2s":       bench.FixedThinkTime(2 * time.Second),
+		"1s-3s":    bench.UniformThinkTime(time.Second, 3*time.Second),
+		"exp:1.5s": bench.ExponentialThinkTime(1500 * time.Millisecond),
+	}
+	for s, want := range testCases {
+		got, err := bench.ParseThinkTime(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if !cmp.Equal(want, got) {
+			t.Errorf("%s: %s", s, cmp.Diff(want, got))
+		}
+		if got.String() != s {
+			t.Errorf("want %q, got %q", s, got)
+		}
+	}
+	for _, s := range []string{"", "2", "1s-", "exp:", "1s-3s-5s"} {
+		_, err := bench.ParseThinkTime(s)
+		if err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
+
+func TestNewTester_ErrorsOnInvalidThinkTimeOrPacing(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bench.Option{
+		"negative think time": bench.WithThinkTime(bench.FixedThinkTime(-time.Second)),
+		"inverted range":      bench.WithThinkTime(bench.UniformThinkTime(3*time.Second, time.Second)),
+		"negative mean":       bench.WithThinkTime(bench.ExponentialThinkTime(-time.Second)),
+		"unknown":             bench.WithThinkTime(bench.ThinkTime{Distribution: "bogus"}),
+		"negative pacing":     bench.WithPacing(-time.Second),
+	}
+	for name, opt := range testCases {
+		_, err := bench.NewTester(bench.WithURL("http://fake.url"), opt)
+		if err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestFromArgs_ThinkAndPacingFlagsSetThinkTimeAndPacing(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs([]string{"-think", "1s-3s", "-pacing", "2s", "-u", "http://fake.url"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bench.UniformThinkTime(time.Second, 3*time.Second)
+	if !cmp.Equal(want, tester.ThinkTime()) {
+		t.Error(cmp.Diff(want, tester.ThinkTime()))
+	}
+	if tester.Pacing() != 2*time.Second {
+		t.Errorf("want pacing 2s, got %s", tester.Pacing())
+	}
+}
+
+func TestFromConfig_SetsThinkTimeAndPacing(t *testing.T) {
+	t.Parallel()
+	config := "url: http://fake.url\nthinkTime: exp:500ms\npacing: 2s\n"
+	tester, err := bench.NewTester(bench.FromConfig(strings.NewReader(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bench.ExponentialThinkTime(500 * time.Millisecond)
+	if !cmp.Equal(want, tester.ThinkTime()) {
+		t.Error(cmp.Diff(want, tester.ThinkTime()))
+	}
+	if tester.Pacing() != 2*time.Second {
+		t.Errorf("want pacing 2s, got %s", tester.Pacing())
+	}
+}
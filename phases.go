@@ -0,0 +1,215 @@
+package bench
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// Names of the phases of a request timed separately. TTFB is measured from
+// when the request is fully written, so that the phases add up to the whole
+// request instead of overlapping
+const (
+	PhaseDNS      = "DNS"
+	PhaseConnect  = "Connect"
+	PhaseTLS      = "TLS"
+	PhaseTTFB     = "TTFB"
+	PhaseTransfer = "Transfer"
+)
+
+// phases lists the phases of a request in the order they happen
+var phases = []string{PhaseDNS, PhaseConnect, PhaseTLS, PhaseTTFB, PhaseTransfer}
+
+// PhaseStats is the struct to store the statistical information about a phase
+// of the requests. Only the requests going through the phase are accounted,
+// e.g. requests reusing a connection do not add to the DNS, Connect and TLS
+// phases
+type PhaseStats struct {
+	Mean float64
+	P50  float64
+	P90  float64
+	P99  float64
+}
+
+// phaseTimer records when each phase of a single request starts and ends. A
+// connection dialed for a request may end up serving another one, so its
+// hooks can run after the request is done, hence the mutex
+type phaseTimer struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	transferDone              time.Time
+}
+
+// trace returns the hooks filling the timer while the request is sent
+func (p *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.stamp(&p.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { p.stamp(&p.dnsDone) },
+		ConnectStart: func(string, string) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.connectStart.IsZero() {
+				p.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.stamp(&p.connectDone)
+			}
+		},
+		TLSHandshakeStart:    func() { p.stamp(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.stamp(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.stamp(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.stamp(&p.firstByte) },
+	}
+}
+
+// stamp sets the given time of the timer to now
+func (p *phaseTimer) stamp(t *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*t = time.Now()
+}
+
+// durations returns how long each phase took in milliseconds, leaving out the
+// phases the request did not go through
+func (p *phaseTimer) durations() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	durations := map[string]float64{}
+	add := func(phase string, start, end time.Time) {
+		if start.IsZero() || end.IsZero() {
+			return
+		}
+		durations[phase] = float64(end.Sub(start).Nanoseconds()) / 1000000.0
+	}
+	add(PhaseDNS, p.dnsStart, p.dnsDone)
+	add(PhaseConnect, p.connectStart, p.connectDone)
+	add(PhaseTLS, p.tlsStart, p.tlsDone)
+	add(PhaseTTFB, p.wroteRequest, p.firstByte)
+	add(PhaseTransfer, p.firstByte, p.transferDone)
+	return durations
+}
+
+// calculatePhases sets the statistics of each phase recorded in tr to the
+// given stats
+func calculatePhases(tr TimeRecorder, stats *Stats) {
+	for _, phase := range phases {
+		times := tr.PhasesTime[phase]
+		if times.TotalCount() == 0 {
+			continue
+		}
+		if stats.Phases == nil {
+			stats.Phases = map[string]PhaseStats{}
+		}
+		stats.Phases[phase] = PhaseStats{
+			Mean: times.Mean(),
+			P50:  times.ValueAtPercentile(50),
+			P90:  times.ValueAtPercentile(90),
+			P99:  times.ValueAtPercentile(99),
+		}
+	}
+}
+
+// phasesString returns the lines of the phases stats in the order the phases
+// happen
+func phasesString(s Stats) string {
+	buf := &strings.Builder{}
+	for _, phase := range phases {
+		ps, ok := s.Phases[phase]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(buf, "\n%sMean(ms): %.3f", phase, ps.Mean)
+		fmt.Fprintf(buf, "\n%sP50(ms): %.3f", phase, ps.P50)
+		fmt.Fprintf(buf, "\n%sP90(ms): %.3f", phase, ps.P90)
+		fmt.Fprintf(buf, "\n%sP99(ms): %.3f", phase, ps.P99)
+	}
+	return buf.String()
+}
+
+// readPhaseLine sets the phase metric named by field, e.g. TLSP99(ms):, to the
+// given stats. It returns false if field is not a phase metric
+func readPhaseLine(stats *Stats, field, value string) (bool, error) {
+	for _, phase := range phases {
+		if !strings.HasPrefix(field, phase) {
+			continue
+		}
+		ps := stats.Phases[phase]
+		var metric *float64
+		switch strings.TrimPrefix(field, phase) {
+		case "Mean(ms):":
+			metric = &ps.Mean
+		case "P50(ms):":
+			metric = &ps.P50
+		case "P90(ms):":
+			metric = &ps.P90
+		case "P99(ms):":
+			metric = &ps.P99
+		default:
+			continue
+		}
+		valueConv, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return true, err
+		}
+		*metric = valueConv
+		if stats.Phases == nil {
+			stats.Phases = map[string]PhaseStats{}
+		}
+		stats.Phases[phase] = ps
+		return true, nil
+	}
+	return false, nil
+}
+
+// PhasesGraph generates a graph stacking the mean and percentiles of each
+// phase of the requests
+func (t Tester) PhasesGraph() error {
+	if len(t.overall.stats.Phases) == 0 {
+		return ErrTimeNotRecorded
+	}
+	p := plot.New()
+	p.Title.Text = "Latency per phase"
+	p.Y.Label.Text = "latency (ms)"
+	p.X.Label.Text = t.URL
+	p.NominalX("Mean", "P50", "P90", "P99")
+	p.Legend.Top = true
+	w := vg.Points(40)
+	var below *plotter.BarChart
+	for i, phase := range phases {
+		ps, ok := t.overall.stats.Phases[phase]
+		if !ok {
+			continue
+		}
+		bars, err := plotter.NewBarChart(plotter.Values{ps.Mean, ps.P50, ps.P90, ps.P99}, w)
+		if err != nil {
+			return err
+		}
+		bars.LineStyle.Width = vg.Length(0)
+		bars.Color = plotutil.Color(i)
+		if below != nil {
+			bars.StackOn(below)
+		}
+		below = bars
+		p.Add(bars)
+		p.Legend.Add(phase, bars)
+	}
+	err := p.Save(600, 400, fmt.Sprintf("%s/%s", t.OutputPath(), "phases.png"))
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package bench_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestRun_RecordsTimeSpentInEachPhase(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithRequests(4),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := tester.Stats().Phases
+	for _, phase := range []string{bench.PhaseConnect, bench.PhaseTLS, bench.PhaseTTFB, bench.PhaseTransfer} {
+		if _, ok := phases[phase]; !ok {
+			t.Errorf("want stats for phase %s", phase)
+		}
+	}
+	// the server URL is an IP address, so there is nothing to resolve
+	if _, ok := phases[bench.PhaseDNS]; ok {
+		t.Errorf("want no stats for phase %s", bench.PhaseDNS)
+	}
+	if phases[bench.PhaseTTFB].P50 < 10 {
+		t.Errorf("want TTFB to include the 10ms the server takes to answer, got %.3f", phases[bench.PhaseTTFB].P50)
+	}
+}
+
+func TestStatsString_PrintsPhasesInOrder(t *testing.T) {
+	t.Parallel()
+	stats := bench.Stats{
+		Phases: map[string]bench.PhaseStats{
+			bench.PhaseTTFB: {Mean: 4, P50: 3, P90: 6, P99: 9},
+			bench.PhaseTLS:  {Mean: 2, P50: 2, P90: 3, P99: 5},
+		},
+	}
+	want := `TLSMean(ms): 2.000
+TLSP50(ms): 2.000
+TLSP90(ms): 3.000
+TLSP99(ms): 5.000
+TTFBMean(ms): 4.000
+TTFBP50(ms): 3.000
+TTFBP90(ms): 6.000
+TTFBP99(ms): 9.000`
+	got := stats.String()
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("want stats to end with the phases:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestReadStats_PopulatesPhasesStats(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:      "http://fake.url",
+		Requests: 10,
+		Phases: map[string]bench.PhaseStats{
+			bench.PhaseDNS:      {Mean: 1.5, P50: 1, P90: 2, P99: 3},
+			bench.PhaseConnect:  {Mean: 2.5, P50: 2, P90: 3, P99: 4},
+			bench.PhaseTLS:      {Mean: 10.25, P50: 10, P90: 12, P99: 20},
+			bench.PhaseTTFB:     {Mean: 50, P50: 45, P90: 80, P99: 120},
+			bench.PhaseTransfer: {Mean: 0.5, P50: 0.4, P90: 0.9, P99: 1.2},
+		},
+	}
+	got, err := bench.ReadStats(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
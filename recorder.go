@@ -0,0 +1,182 @@
+package bench
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+)
+
+// statsRecorder stores the stats and execution times of the requests of a
+// benchmark, or of part of them, the ones sent during a stage or to an
+// endpoint. Its methods do nothing on a nil statsRecorder, so the requests of
+// a benchmark without stages or endpoints can be recorded the same way
+type statsRecorder struct {
+	mu           *sync.Mutex
+	hashes       map[[sha256.Size]byte]bool
+	responses    int
+	stats        Stats
+	TimeRecorder TimeRecorder
+}
+
+func newStatsRecorder(precision int) *statsRecorder {
+	return &statsRecorder{
+		mu:           &sync.Mutex{},
+		TimeRecorder: newTimeRecorder(precision),
+	}
+}
+
+func (s *statsRecorder) recordRequest() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Requests++
+}
+
+func (s *statsRecorder) recordSuccess() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Successes++
+}
+
+// recordFailure records a failed request. An unexpected status code is only a
+// failure, an assertionError is also an assertion failure, and any other
+// error is also counted by its category, as the request got no valid response
+func (s *statsRecorder) recordFailure(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Failures++
+	var status statusError
+	var assertion assertionError
+	switch {
+	case err == nil, errors.As(err, &status):
+	case errors.As(err, &assertion):
+		s.stats.AssertionFailures++
+	default:
+		addError(&s.stats, ErrorCategory(err))
+	}
+}
+
+func (s *statsRecorder) recordStatus(code int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addStatus(&s.stats, code)
+}
+
+func (s *statsRecorder) recordResponseHash(sum [sha256.Size]byte) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes == nil {
+		s.hashes = map[[sha256.Size]byte]bool{}
+	}
+	if !s.hashes[sum] {
+		s.hashes[sum] = true
+		s.stats.DistinctResponses++
+	}
+}
+
+func (s *statsRecorder) recordSession() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Sessions++
+}
+
+func (s *statsRecorder) recordTransfer(sent, received int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.BytesSent += sent
+	s.stats.BytesReceived += received
+	s.responses++
+}
+
+func (s *statsRecorder) recordLate() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Late++
+}
+
+func (s *statsRecorder) recordDropped(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Dropped += n
+}
+
+func (s *statsRecorder) recordSkipped() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Skipped++
+}
+
+// recorders are the statsRecorders a request is recorded to, i.e. the one of
+// the whole benchmark and the ones of its stage and of its endpoint
+type recorders []*statsRecorder
+
+func (rs recorders) recordRequest() {
+	for _, s := range rs {
+		s.recordRequest()
+	}
+}
+
+func (rs recorders) recordSuccess() {
+	for _, s := range rs {
+		s.recordSuccess()
+	}
+}
+
+func (rs recorders) recordFailure(err error) {
+	for _, s := range rs {
+		s.recordFailure(err)
+	}
+}
+
+func (rs recorders) recordStatus(code int) {
+	for _, s := range rs {
+		s.recordStatus(code)
+	}
+}
+
+func (rs recorders) recordResponseHash(sum [sha256.Size]byte) {
+	for _, s := range rs {
+		s.recordResponseHash(sum)
+	}
+}
+
+func (rs recorders) recordSession() {
+	for _, s := range rs {
+		s.recordSession()
+	}
+}
+
+func (rs recorders) recordTransfer(sent, received int64) {
+	for _, s := range rs {
+		s.recordTransfer(sent, received)
+	}
+}
@@ -0,0 +1,212 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stageTick sets how often the number of active users is adjusted while
+// running a load profile
+const stageTick = 100 * time.Millisecond
+
+// Stage is a step of a load profile. During Duration, the number of active
+// users moves linearly from the Target of the previous stage (zero for the
+// first one) to Target
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// String returns the stage in the same format accepted by ParseStages
+func (s Stage) String() string {
+	return fmt.Sprintf("%s:%d", s.Duration, s.Target)
+}
+
+// WithStages is the functional option to set a load profile while
+// initializing a new Tester object. When set, the benchmark lasts for the sum
+// of the stages durations and the number of users is driven by the stages
+// instead of the concurrency
+func WithStages(stages ...Stage) Option {
+	return func(t *Tester) error {
+		t.stages = stages
+		return nil
+	}
+}
+
+// Stages returns the configured load profile
+func (t Tester) Stages() []Stage {
+	return t.stages
+}
+
+// ParseStages parses a comma separated list of stages in the format
+// duration:target, e.g. "30s:50,2m:50,30s:200,10s:0"
+func ParseStages(s string) ([]Stage, error) {
+	stages := []Stage{}
+	for _, field := range strings.Split(s, ",") {
+		stage, err := parseStage(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// ReadStagesFile is a wrapper to avoid user paperwork of opening the file
+func ReadStagesFile(path string) ([]Stage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stages, err := ReadStages(f)
+	if err != nil {
+		return nil, fmt.Errorf("filename %q, err: %v", path, err)
+	}
+	return stages, nil
+}
+
+// ReadStages reads one stage per line in the format duration:target from a
+// given io.Reader. Empty lines and lines starting with # are ignored
+func ReadStages(r io.Reader) ([]Stage, error) {
+	scanner := bufio.NewScanner(r)
+	stages := []Stage{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		stage, err := parseStage(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		stages = append(stages, stage)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return stages, nil
+}
+
+func parseStage(s string) (Stage, error) {
+	pos := strings.Split(s, ":")
+	if len(pos) != 2 {
+		return Stage{}, fmt.Errorf("invalid stage %q, want duration:target", s)
+	}
+	d, err := time.ParseDuration(pos[0])
+	if err != nil {
+		return Stage{}, fmt.Errorf("invalid stage %q: %v", s, err)
+	}
+	target, err := strconv.Atoi(pos[1])
+	if err != nil {
+		return Stage{}, fmt.Errorf("invalid stage %q: %v", s, err)
+	}
+	return Stage{Duration: d, Target: target}, nil
+}
+
+// validateStages checks the stages make a load profile that can be run
+func validateStages(stages []Stage) error {
+	var total time.Duration
+	for _, s := range stages {
+		if s.Duration < 0 {
+			return fmt.Errorf("stage %s has invalid duration", s)
+		}
+		if s.Target < 0 {
+			return fmt.Errorf("stage %s has invalid target", s)
+		}
+		total += s.Duration
+	}
+	if total == 0 {
+		return fmt.Errorf("stages %v have no duration", stages)
+	}
+	return nil
+}
+
+// stageAt returns the index of the stage running at the given time since the
+// start of the benchmark and how many users should be active at that time
+func (t *Tester) stageAt(elapsed time.Duration) (int, int) {
+	previous := 0
+	for i, s := range t.stages {
+		if elapsed < s.Duration {
+			progress := float64(elapsed) / float64(s.Duration)
+			users := float64(previous) + float64(s.Target-previous)*progress
+			return i, int(math.Round(users))
+		}
+		elapsed -= s.Duration
+		previous = s.Target
+	}
+	return len(t.stages) - 1, previous
+}
+
+// runStages starts and stops users following the load profile until the
+// work channel is closed
+func (t *Tester) runStages(ctx context.Context) {
+	defer t.wg.Done()
+	ticker := time.NewTicker(stageTick)
+	defer ticker.Stop()
+	quits := []chan struct{}{}
+	for {
+		_, users := t.stageAt(time.Since(t.startAt))
+		for len(quits) < users {
+			quit := make(chan struct{})
+			quits = append(quits, quit)
+			t.wg.Add(1)
+			go func(worker int) {
+				t.doRequests(ctx, worker, quit)
+				t.wg.Done()
+			}(len(quits) - 1)
+		}
+		for len(quits) > users {
+			close(quits[len(quits)-1])
+			quits = quits[:len(quits)-1]
+		}
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			for _, quit := range quits {
+				close(quit)
+			}
+			return
+		}
+	}
+}
+
+// stageRecorder returns the recorder of the stage running at the given time
+// since the start of the benchmark, or nil if there are no stages
+func (t *Tester) stageRecorder(elapsed time.Duration) *statsRecorder {
+	if len(t.stageRecorders) == 0 {
+		return nil
+	}
+	i, _ := t.stageAt(elapsed)
+	return t.stageRecorders[i]
+}
+
+// calculateStages breaks the stats down per stage. The throughput of each
+// stage is calculated over the time it actually ran, which is shorter than its
+// duration, or none at all, when the run was stopped before the end
+func (t *Tester) calculateStages() {
+	t.overall.stats.Stages = nil
+	var start time.Duration
+	for i, s := range t.stageRecorders {
+		elapsed := t.endAt - start
+		if elapsed > t.stages[i].Duration {
+			elapsed = t.stages[i].Duration
+		}
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		start += t.stages[i].Duration
+		stats := s.stats
+		calculatePercentiles(s.TimeRecorder, &stats, t.percentiles)
+		stats.URL = t.URL
+		calculateThroughput(&stats, elapsed, s.responses)
+		t.overall.stats.Stages = append(t.overall.stats.Stages, stats)
+	}
+}
@@ -0,0 +1,274 @@
+package bench_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestParseStages_ParsesCommaSeparatedStages(t *testing.T) {
+	t.Parallel()
+	got, err := bench.ParseStages("30s:50, 2m:50,30s:200,10s:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Stage{
+		{Duration: 30 * time.Second, Target: 50},
+		{Duration: 2 * time.Minute, Target: 50},
+		{Duration: 30 * time.Second, Target: 200},
+		{Duration: 10 * time.Second, Target: 0},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestParseStages_ErrorsOnInvalidStage(t *testing.T) {
+	t.Parallel()
+	inputs := []string{
+		"",
+		"30s",
+		"30s:fifty",
+		"thirty:50",
+		"30s:50:1",
+	}
+	for _, input := range inputs {
+		_, err := bench.ParseStages(input)
+		if err == nil {
+			t.Errorf("want error for invalid stages %q", input)
+		}
+	}
+}
+
+func TestReadStages_IgnoresCommentsAndEmptyLines(t *testing.T) {
+	t.Parallel()
+	got, err := bench.ReadStages(strings.NewReader(`# ramp up
+30s:50
+
+2m:50
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Stage{
+		{Duration: 30 * time.Second, Target: 50},
+		{Duration: 2 * time.Minute, Target: 50},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestReadStages_ErrorsWithLineNumber(t *testing.T) {
+	t.Parallel()
+	_, err := bench.ReadStages(strings.NewReader("30s:50\n2m\n"))
+	if err == nil {
+		t.Fatal("want error for invalid stage")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("want error to point to line 2, got %q", err)
+	}
+}
+
+func TestWithStages_SetsStagesAndDuration(t *testing.T) {
+	t.Parallel()
+	stages := []bench.Stage{
+		{Duration: 30 * time.Second, Target: 50},
+		{Duration: 2 * time.Minute, Target: 50},
+	}
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithStages(stages...),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(stages, tester.Stages()) {
+		t.Error(cmp.Diff(stages, tester.Stages()))
+	}
+	want := 150 * time.Second
+	got := tester.Duration()
+	if want != got {
+		t.Errorf("want duration to be the sum of the stages (%s), got %s", want, got)
+	}
+}
+
+func TestWithStages_ErrorsOnInvalidStages(t *testing.T) {
+	t.Parallel()
+	inputs := [][]bench.Stage{
+		{{Duration: time.Second, Target: -1}},
+		{{Duration: -time.Second, Target: 1}},
+		{{Duration: 0, Target: 1}},
+	}
+	for _, stages := range inputs {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			bench.WithStages(stages...),
+		)
+		if err == nil {
+			t.Errorf("want error for invalid stages %v", stages)
+		}
+	}
+}
+
+func TestFromArgs_StagesFlagSetsStages(t *testing.T) {
+	t.Parallel()
+	args := []string{"-stages", "30s:50,10s:0", "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Stage{
+		{Duration: 30 * time.Second, Target: 50},
+		{Duration: 10 * time.Second, Target: 0},
+	}
+	got := tester.Stages()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestFromArgs_StagesFlagReadsStagesFromFile(t *testing.T) {
+	t.Parallel()
+	path := t.TempDir() + "/stages.txt"
+	err := os.WriteFile(path, []byte("30s:50\n10s:0\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-stages", "@" + path, "-u", "http://fake.url"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.Stage{
+		{Duration: 30 * time.Second, Target: 50},
+		{Duration: 10 * time.Second, Target: 0},
+	}
+	got := tester.Stages()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRun_WithStagesBreaksStatsDownPerStage(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(rw, "HelloWorld")
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithStages(
+			bench.Stage{Duration: 0, Target: 2},
+			bench.Stage{Duration: 300 * time.Millisecond, Target: 2},
+			bench.Stage{Duration: 300 * time.Millisecond, Target: 4},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tester.Stats()
+	if len(stats.Stages) != 3 {
+		t.Fatalf("want stats for 3 stages, got %d", len(stats.Stages))
+	}
+	total := 0
+	for i, stage := range stats.Stages {
+		total += stage.Requests
+		if i > 0 && stage.Requests == 0 {
+			t.Errorf("want requests in stage %d", i+1)
+		}
+	}
+	if total != stats.Requests {
+		t.Errorf("want requests of all stages (%d) to add up to the total (%d)", total, stats.Requests)
+	}
+	if stats.Stages[2].Requests <= stats.Stages[1].Requests {
+		t.Errorf("want more requests with more users, got %d then %d", stats.Stages[1].Requests, stats.Stages[2].Requests)
+	}
+}
+
+func TestRunContext_WithStagesCapsElapsedOfStagesCut(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithStages(
+			bench.Stage{Duration: 200 * time.Millisecond, Target: 2},
+			bench.Stage{Duration: 10 * time.Second, Target: 2},
+			bench.Stage{Duration: 10 * time.Second, Target: 2},
+		),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err = tester.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want error %v, got %v", context.DeadlineExceeded, err)
+	}
+	stages := tester.Stats().Stages
+	if stages[0].Elapsed != 200 {
+		t.Errorf("want first stage to run for 200ms, got %.3f", stages[0].Elapsed)
+	}
+	if stages[1].Elapsed < 200 || stages[1].Elapsed > 2000 {
+		t.Errorf("want second stage to run for about 300ms, got %.3f", stages[1].Elapsed)
+	}
+	wantRPS := float64(stages[1].Requests) / (stages[1].Elapsed / 1000)
+	if math.Abs(wantRPS-stages[1].RPS) > 0.001*wantRPS {
+		t.Errorf("want second stage RPS %.3f over the time it ran, got %.3f", wantRPS, stages[1].RPS)
+	}
+	if stages[2].Elapsed != 0 || stages[2].RPS != 0 {
+		t.Errorf("want no elapsed time nor RPS for the stage not reached, got %.3f and %.3f", stages[2].Elapsed, stages[2].RPS)
+	}
+}
+
+func TestReadStats_PopulatesStagesStats(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:       "http://fake.url",
+		Requests:  30,
+		Successes: 30,
+		P50:       10,
+		Stages: []bench.Stats{
+			{URL: "http://fake.url", Requests: 10, Successes: 10, P50: 9},
+			{URL: "http://fake.url", Requests: 20, Successes: 20, P50: 11},
+		},
+	}
+	got, err := bench.ReadStats(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
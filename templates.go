@@ -0,0 +1,163 @@
+package bench
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data available to the templates of a request. Seq is
+// the index of the request in the run and Worker the index of the user
+// sending it, both starting from zero. Data is the row handed out by the data
+// feeder, if any, e.g. {{.Data.user_id}}, and Vars the values extracted by the
+// previous steps of a flow, e.g. {{.Vars.token}}
+type TemplateData struct {
+	Seq    int64
+	Worker int
+	Data   DataRow
+	Vars   map[string]string
+}
+
+// templateFuncs are the functions available to the templates of a request
+var templateFuncs = template.FuncMap{
+	"randInt":    randInt,
+	"randString": randString,
+	"uuid":       newUUID,
+	"timestamp":  func() int64 { return time.Now().Unix() },
+	"choice":     choice,
+}
+
+const randStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randInt returns a random integer in [min, max)
+func randInt(min, max int) (int, error) {
+	if max <= min {
+		return 0, fmt.Errorf("randInt: max %d must be greater than min %d", max, min)
+	}
+	return min + mathrand.Intn(max-min), nil
+}
+
+// randString returns a random alphanumeric string of length n
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randStringLetters[mathrand.Intn(len(randStringLetters))]
+	}
+	return string(b)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// choice returns one of the given values at random
+func choice(values ...interface{}) (interface{}, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("choice: no values to choose from")
+	}
+	return values[mathrand.Intn(len(values))], nil
+}
+
+// WithTemplates is the functional option to set whether the URL, the headers
+// and the body are Go templates evaluated for each request while initializing
+// a new Tester object. Besides the fields of TemplateData, templates can use
+// the functions randInt min max, randString n, uuid, timestamp (Unix seconds)
+// and choice values..., e.g. {{randInt 1 100}} or {{choice "a" "b"}}
+func WithTemplates(templates bool) Option {
+	return func(t *Tester) error {
+		t.templating = templates
+		return nil
+	}
+}
+
+// Templates returns whether the URL, the headers and the body are evaluated
+// as templates for each request
+func (t Tester) Templates() bool {
+	return t.templating
+}
+
+// requestTemplates holds the parsed templates of the parts of a request
+type requestTemplates struct {
+	url     *template.Template
+	body    *template.Template
+	headers map[string][]*template.Template
+}
+
+func newRequestTemplates(rawURL string, body []byte, headers http.Header) (*requestTemplates, error) {
+	parse := func(name, text string) (*template.Template, error) {
+		tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %v", name, err)
+		}
+		return tpl, nil
+	}
+	rt := &requestTemplates{headers: map[string][]*template.Template{}}
+	var err error
+	rt.url, err = parse("URL", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	rt.body, err = parse("body", string(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		for _, value := range values {
+			tpl, err := parse(name+" header", value)
+			if err != nil {
+				return nil, err
+			}
+			rt.headers[name] = append(rt.headers[name], tpl)
+		}
+	}
+	return rt, nil
+}
+
+// render evaluates the templates with data, returning the URL, the body and
+// the headers of a request
+func (rt *requestTemplates) render(data TemplateData) (string, []byte, http.Header, error) {
+	buf := &bytes.Buffer{}
+	err := rt.url.Execute(buf, data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	rawURL := buf.String()
+	body := &bytes.Buffer{}
+	err = rt.body.Execute(body, data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	headers := http.Header{}
+	for name, tpls := range rt.headers {
+		for _, tpl := range tpls {
+			buf.Reset()
+			err := tpl.Execute(buf, data)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			headers[name] = append(headers[name], buf.String())
+		}
+	}
+	return rawURL, body.Bytes(), headers, nil
+}
+
+// validate checks the templates can be evaluated with data into a valid URL
+func (rt *requestTemplates) validate(data TemplateData) error {
+	rawURL, _, _, err := rt.render(data)
+	if err != nil {
+		return err
+	}
+	return validateURL(rawURL)
+}
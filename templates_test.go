@@ -0,0 +1,146 @@
+package bench_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/thiagonache/bench"
+)
+
+func TestRun_WithTemplatesEvaluatesURLHeadersAndBodyPerRequest(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	paths := []string{}
+	bodyRE := regexp.MustCompile(`^{"id": "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}", "n": ([1-9]), "s": "[a-zA-Z0-9]{5}", "c": "(red|blue)", "ts": \d+}$`)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !bodyRE.Match(body) {
+			http.Error(rw, "UnexpectedBody", http.StatusBadRequest)
+			return
+		}
+		worker, err := strconv.Atoi(r.Header.Get("X-Worker"))
+		if err != nil || worker < 0 || worker > 1 {
+			http.Error(rw, "UnexpectedWorker", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL+"/items/{{.Seq}}"),
+		bench.WithRequests(4),
+		bench.WithConcurrency(2),
+		bench.WithHTTPMethod(http.MethodPost),
+		bench.WithHeader("X-Worker", "{{.Worker}}"),
+		bench.WithBody(`{"id": "{{uuid}}", "n": {{randInt 1 10}}, "s": "{{randString 5}}", "c": "{{choice "red" "blue"}}", "ts": {{timestamp}}}`),
+		bench.WithTemplates(true),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Failures > 0 {
+		t.Fatalf("want no failures, got %d", tester.Stats().Failures)
+	}
+	sort.Strings(paths)
+	want := []string{"/items/0", "/items/1", "/items/2", "/items/3"}
+	if !cmp.Equal(want, paths) {
+		t.Error(cmp.Diff(want, paths))
+	}
+}
+
+func TestWithTemplates_ErrorsOnInvalidTemplates(t *testing.T) {
+	t.Parallel()
+	testCases := map[string][]bench.Option{
+		"URL syntax":       {bench.WithURL("http://fake.url/{{.Seq")},
+		"URL without host": {bench.WithURL("{{.Seq}}")},
+		"body syntax":      {bench.WithURL("http://fake.url"), bench.WithBody("{{randInt 1}")},
+		"header syntax":    {bench.WithURL("http://fake.url"), bench.WithHeader("X-Id", "{{uuid")},
+		"unknown field":    {bench.WithURL("http://fake.url/{{.Bogus}}")},
+		"unknown func":     {bench.WithURL("http://fake.url"), bench.WithBody("{{bogus}}")},
+	}
+	for name, opts := range testCases {
+		_, err := bench.NewTester(append(opts, bench.WithTemplates(true))...)
+		if err == nil {
+			t.Errorf("%s: want error for invalid template", name)
+		}
+	}
+}
+
+func TestFromArgs_TemplateFlagSetsTemplates(t *testing.T) {
+	t.Parallel()
+	args := []string{"-template", "-u", "http://fake.url/items/{{randInt 1 100}}"}
+	tester, err := bench.NewTester(
+		bench.WithStderr(io.Discard),
+		bench.FromArgs(args),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tester.Templates() {
+		t.Error("want templates to be true")
+	}
+}
+
+func TestRun_ByDefaultSendsTemplatesAsTheyAre(t *testing.T) {
+	t.Parallel()
+	want := `{"template": "{{.Seq}}"}`
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got, err := io.ReadAll(r.Body)
+		if err != nil || want != string(got) {
+			http.Error(rw, "UnexpectedBody", http.StatusBadRequest)
+		}
+	}))
+	tester, err := bench.NewTester(
+		bench.WithURL(server.URL),
+		bench.WithHTTPMethod(http.MethodPost),
+		bench.WithBody(want),
+		bench.WithHTTPClient(server.Client()),
+		bench.WithStdout(io.Discard),
+		bench.WithStderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tester.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tester.Stats().Failures > 0 {
+		t.Errorf("want body to be sent as it is, got %d failures", tester.Stats().Failures)
+	}
+}
+
+func TestReadStats_PopulatesTemplatedURLs(t *testing.T) {
+	t.Parallel()
+	want := bench.Stats{
+		URL:       "http://fake.url/items/{{randInt 1 1000}}",
+		Requests:  10,
+		Successes: 10,
+		Endpoints: map[string]bench.Stats{
+			"item": {URL: "http://fake.url/items/{{randInt 1 1000}}", Requests: 10, Successes: 10},
+		},
+	}
+	got, err := bench.ReadStats(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
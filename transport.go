@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrTransportWithHTTPClient is the error for when transport options or
+// keep-alive are combined with a custom http.Client, whose transport is never
+// changed
+var ErrTransportWithHTTPClient = errors.New("transport options cannot be used with a custom HTTP client")
+
+// transportConfig holds the settings of the transport built for each Tester
+// not given a custom http.Client
+type transportConfig struct {
+	dialTimeout     time.Duration
+	idleConnTimeout time.Duration
+	maxIdleConns    int
+	tlsConfig       *tls.Config
+}
+
+// WithDialTimeout is the functional option to set how long to wait for a
+// connection to be established while initializing a new Tester object
+func WithDialTimeout(d time.Duration) Option {
+	return func(t *Tester) error {
+		if d <= 0 {
+			return fmt.Errorf("%s is invalid dial timeout", d)
+		}
+		t.transport.dialTimeout = d
+		return nil
+	}
+}
+
+// WithIdleConnTimeout is the functional option to set how long an idle
+// connection is kept open to be reused while initializing a new Tester object
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(t *Tester) error {
+		if d <= 0 {
+			return fmt.Errorf("%s is invalid idle connection timeout", d)
+		}
+		t.transport.idleConnTimeout = d
+		return nil
+	}
+}
+
+// WithMaxIdleConns is the functional option to set how many idle connections
+// are kept open to be reused while initializing a new Tester object. By
+// default, one connection per user is kept
+func WithMaxIdleConns(n int) Option {
+	return func(t *Tester) error {
+		if n < 1 {
+			return fmt.Errorf("%d is invalid number of idle connections", n)
+		}
+		t.transport.maxIdleConns = n
+		return nil
+	}
+}
+
+// WithTLSConfig is the functional option to set the TLS settings of the
+// connections while initializing a new Tester object
+func WithTLSConfig(config *tls.Config) Option {
+	return func(t *Tester) error {
+		if config == nil {
+			return ErrValueCannotBeNil
+		}
+		t.transport.tlsConfig = config.Clone()
+		return nil
+	}
+}
+
+// newHTTPClient builds an http.Client with a transport of its own, so that
+// Testers never share connections or settings with each other. It returns
+// redirects instead of following them when a redirection is expected
+func (t *Tester) newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = !t.keepAlive
+	transport.MaxIdleConnsPerHost = t.concurrency
+	for _, s := range t.stages {
+		if s.Target > transport.MaxIdleConnsPerHost {
+			transport.MaxIdleConnsPerHost = s.Target
+		}
+	}
+	if transport.MaxIdleConnsPerHost > transport.MaxIdleConns {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+	if t.transport.maxIdleConns > 0 {
+		transport.MaxIdleConns = t.transport.maxIdleConns
+		transport.MaxIdleConnsPerHost = t.transport.maxIdleConns
+	}
+	if t.transport.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = t.transport.idleConnTimeout
+	}
+	if t.transport.tlsConfig != nil {
+		transport.TLSClientConfig = t.transport.tlsConfig
+	}
+	if t.transport.dialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   t.transport.dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	client := &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: transport,
+	}
+	if t.expectsRedirect() {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
@@ -0,0 +1,142 @@
+package bench_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thiagonache/bench"
+)
+
+func TestNewTester_BuildsHTTPClientOfItsOwn(t *testing.T) {
+	t.Parallel()
+	testers := make([]*bench.Tester, 10)
+	var wg sync.WaitGroup
+	for i := range testers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tester, err := bench.NewTester(
+				bench.WithURL("http://fake.url"),
+				bench.WithKeepAlive(i%2 == 0),
+			)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			testers[i] = tester
+		}(i)
+	}
+	wg.Wait()
+	clients := map[*http.Client]bool{}
+	for i, tester := range testers {
+		if tester == nil {
+			t.FailNow()
+		}
+		c := tester.HTTPClient()
+		if c == bench.DefaultHTTPClient {
+			t.Fatal("want a client other than the shared default one")
+		}
+		clients[c] = true
+		want := i%2 != 0
+		got := c.Transport.(*http.Transport).DisableKeepAlives
+		if want != got {
+			t.Errorf("tester %d: want DisableKeepAlives %t, got %t", i, want, got)
+		}
+	}
+	if len(clients) != len(testers) {
+		t.Errorf("want %d distinct clients, got %d", len(testers), len(clients))
+	}
+	if bench.DefaultHTTPClient.Transport != nil {
+		t.Error("want the shared default client to be left untouched")
+	}
+}
+
+func TestNewTester_AppliesTransportOptions(t *testing.T) {
+	t.Parallel()
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithMaxIdleConns(50),
+		bench.WithIdleConnTimeout(10*time.Second),
+		bench.WithTLSConfig(tlsConfig),
+		bench.WithDialTimeout(2*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := tester.HTTPClient().Transport.(*http.Transport)
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 50 {
+		t.Errorf("want 50 idle connections, got %d (%d per host)", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 10*time.Second {
+		t.Errorf("want idle connection timeout of 10s, got %s", transport.IdleConnTimeout)
+	}
+	if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("want TLS config to skip verification")
+	}
+	if transport.TLSClientConfig == tlsConfig {
+		t.Error("want TLS config to be copied")
+	}
+	if transport.DialContext == nil {
+		t.Error("want dialer with timeout")
+	}
+}
+
+func TestNewTester_ByDefaultKeepsOneIdleConnectionPerUser(t *testing.T) {
+	t.Parallel()
+	tester, err := bench.NewTester(
+		bench.WithURL("http://fake.url"),
+		bench.WithConcurrency(200),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := tester.HTTPClient().Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 200 || transport.MaxIdleConns < 200 {
+		t.Errorf("want 200 idle connections, got %d (%d per host)", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestNewTester_ErrorsOnTransportOptionsWithCustomHTTPClient(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bench.Option{
+		"max idle conns": bench.WithMaxIdleConns(10),
+		"keep-alive":     bench.WithKeepAlive(true),
+	}
+	for name, opt := range testCases {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			bench.WithHTTPClient(&http.Client{}),
+			opt,
+			bench.WithStderr(io.Discard),
+		)
+		if !errors.Is(err, bench.ErrTransportWithHTTPClient) {
+			t.Errorf("%s: want error %v, got %v", name, bench.ErrTransportWithHTTPClient, err)
+		}
+	}
+}
+
+func TestTransportOptions_ErrorOnInvalidValues(t *testing.T) {
+	t.Parallel()
+	opts := map[string]bench.Option{
+		"WithDialTimeout":     bench.WithDialTimeout(0),
+		"WithIdleConnTimeout": bench.WithIdleConnTimeout(-time.Second),
+		"WithMaxIdleConns":    bench.WithMaxIdleConns(0),
+		"WithTLSConfig":       bench.WithTLSConfig(nil),
+		"WithHTTPClient":      bench.WithHTTPClient(nil),
+	}
+	for name, opt := range opts {
+		_, err := bench.NewTester(
+			bench.WithURL("http://fake.url"),
+			opt,
+		)
+		if err == nil {
+			t.Errorf("%s: want error for invalid value", name)
+		}
+	}
+}